@@ -0,0 +1,48 @@
+package micros
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"reflect"
+	"sync/atomic"
+)
+
+// RegisterAPI registers impl on the gRPC server and, when gatewayRegister is not nil, the REST gateway
+// handlers for the API on the runtime mux. InitGRPC must have been called and the service must not be running.
+//
+// Use RegisterXHandler generated by grpc-gateway to call the API through the gRPC client connection or
+// InProcessGateway with RegisterXHandlerServer to call impl directly without a network hop
+func (service *Service) RegisterAPI(desc *grpc.ServiceDesc, impl interface{}, gatewayRegister GatewayRegisterFunc) error {
+	switch {
+	case desc == nil:
+		return errors.New("nil service description")
+	case impl == nil:
+		return errors.Errorf("nil implementation for %s", desc.ServiceName)
+	case service.gRPCServer == nil:
+		return errors.Errorf("InitGRPC must be called before registering %s", desc.ServiceName)
+	case atomic.LoadInt32(&service.running) == 1:
+		return errors.Errorf("cannot register %s after service has started running", desc.ServiceName)
+	}
+
+	if _, ok := service.gRPCServer.GetServiceInfo()[desc.ServiceName]; ok {
+		return errors.Errorf("service %s is already registered", desc.ServiceName)
+	}
+
+	handlerType := reflect.TypeOf(desc.HandlerType).Elem()
+	if !reflect.TypeOf(impl).Implements(handlerType) {
+		return errors.Errorf("%T does not implement %s", impl, handlerType)
+	}
+
+	service.gRPCServer.RegisterService(desc, impl)
+
+	if gatewayRegister == nil {
+		return nil
+	}
+
+	err := gatewayRegister(service.ctx, service.RuntimeMux(), service.ClientConn())
+	if err != nil {
+		return errors.Wrapf(err, "failed to register gateway handlers for %s", desc.ServiceName)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package micros
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// backgroundShutdownTimeout bounds how long shutdown waits for background tasks to return
+const backgroundShutdownTimeout = 30 * time.Second
+
+// backgroundTask runs until its context is done
+type backgroundTask struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// background holds the tasks started and stopped with the service
+type background struct {
+	mu      sync.Mutex
+	tasks   []backgroundTask
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	checks  map[string]func(ctx context.Context) error
+	started bool
+}
+
+// addBackgroundTask registers a task started by Run. Tasks added while the service is running start immediately
+func (service *Service) addBackgroundTask(name string, run func(ctx context.Context) error) {
+	service.background.mu.Lock()
+	defer service.background.mu.Unlock()
+
+	task := backgroundTask{name: name, run: run}
+	service.background.tasks = append(service.background.tasks, task)
+	if service.background.started {
+		service.startBackgroundTask(task)
+	}
+}
+
+// startBackgroundTasks starts the registered tasks with a context derived from ctx
+func (service *Service) startBackgroundTasks(ctx context.Context) {
+	service.background.mu.Lock()
+	defer service.background.mu.Unlock()
+
+	if service.background.started {
+		return
+	}
+	service.background.ctx, service.background.cancel = context.WithCancel(ctx)
+	service.background.started = true
+
+	for _, task := range service.background.tasks {
+		service.startBackgroundTask(task)
+	}
+}
+
+func (service *Service) startBackgroundTask(task backgroundTask) {
+	service.background.wg.Add(1)
+	go func() {
+		defer service.background.wg.Done()
+		err := task.run(service.background.ctx)
+		if err != nil && service.background.ctx.Err() == nil {
+			service.logger.Error("background task stopped", "task", task.name, "error", err)
+		}
+	}()
+}
+
+// stopBackgroundTasks cancels the running tasks and waits for them to return
+func (service *Service) stopBackgroundTasks() {
+	service.background.mu.Lock()
+	if !service.background.started {
+		service.background.mu.Unlock()
+		return
+	}
+	service.background.started = false
+	service.background.cancel()
+	service.background.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		service.background.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(backgroundShutdownTimeout):
+		service.logger.Warn("background tasks did not stop in time", "timeout", backgroundShutdownTimeout)
+	}
+}
+
+// AddHealthCheck registers a check reported by CheckHealth, e.g. by the health check probes
+func (service *Service) AddHealthCheck(name string, check func(ctx context.Context) error) {
+	service.background.mu.Lock()
+	defer service.background.mu.Unlock()
+
+	if service.background.checks == nil {
+		service.background.checks = make(map[string]func(ctx context.Context) error)
+	}
+	service.background.checks[name] = check
+}
+
+// CheckHealth runs the registered health checks and returns the errors of the failing ones by name
+func (service *Service) CheckHealth(ctx context.Context) map[string]error {
+	service.background.mu.Lock()
+	checks := make(map[string]func(ctx context.Context) error, len(service.background.checks))
+	for name, check := range service.background.checks {
+		checks[name] = check
+	}
+	service.background.mu.Unlock()
+
+	failed := make(map[string]error)
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			failed[name] = err
+		}
+	}
+	return failed
+}
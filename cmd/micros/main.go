@@ -0,0 +1,70 @@
+// Command micros contains developer tooling for micros based services.
+//
+// Usage:
+//
+//	micros certs generate [-hosts localhost,127.0.0.1] [-out certs] [-org name] [-valid-for 8760h]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	microtls "github.com/gidyon/micros/utils/tls"
+)
+
+const usage = `usage: micros <command> [arguments]
+
+commands:
+  certs generate    generate a development CA and certificate signed by it
+`
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] + " " + os.Args[2] {
+	case "certs generate":
+		err := generateCerts(os.Args[3:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func generateCerts(args []string) error {
+	fs := flag.NewFlagSet("certs generate", flag.ExitOnError)
+	var (
+		hosts    = fs.String("hosts", strings.Join(microtls.DefaultHosts, ","), "comma separated DNS names and IPs for the certificate")
+		out      = fs.String("out", "certs", "directory to write ca.pem, ca-key.pem, cert.pem and key.pem")
+		org      = fs.String("org", "", "organization name in certificates subject")
+		validFor = fs.Duration("valid-for", 365*24*time.Hour, "duration that certificates are valid for")
+	)
+	fs.Parse(args)
+
+	certs, err := microtls.GenerateCertificates(&microtls.GenerateOptions{
+		Hosts:        strings.Split(*hosts, ","),
+		Organization: *org,
+		ValidFor:     *validFor,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = certs.WriteFiles(*out)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("certificates written to %s\n", *out)
+
+	return nil
+}
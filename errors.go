@@ -0,0 +1,19 @@
+package micros
+
+import (
+	"github.com/gidyon/micros/pkg/errs"
+	"github.com/gidyon/micros/pkg/gateway"
+	"github.com/pkg/errors"
+)
+
+// EnableErrorTranslation translates errs errors and known database and redis errors returned by gRPC handlers
+// to statuses with the matching code and details. Gateway errors are written as a gateway.ErrorBody.
+// It must be called before InitGRPC and RuntimeMux
+func (service *Service) EnableErrorTranslation() error {
+	if err := service.AddRuntimeMuxOptions(gateway.WithErrorBody()); err != nil {
+		return errors.Wrap(err, "failed to enable error translation")
+	}
+	service.AddGRPCUnaryServerInterceptors(errs.UnaryServerInterceptor())
+	service.AddGRPCStreamServerInterceptors(errs.StreamServerInterceptor())
+	return nil
+}
@@ -0,0 +1,46 @@
+package micros
+
+import (
+	"github.com/gidyon/micros/pkg/events"
+	"github.com/pkg/errors"
+)
+
+// EventOutbox returns an outbox writing to the events table of the service SQL database, which must be MySQL.
+// The table is created if it does not exist
+func (service *Service) EventOutbox() (*events.Outbox, error) {
+	if service.sqlDB == nil {
+		return nil, errors.New("event outbox requires a SQL database")
+	}
+	if err := service.requireMySQL("event outbox"); err != nil {
+		return nil, err
+	}
+	outbox, err := events.NewOutbox(service.sqlDB, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := outbox.CreateTable(service.ctx); err != nil {
+		return nil, err
+	}
+	return outbox, nil
+}
+
+// RedisEventBroker returns a broker publishing and delivering events with redis streams
+// using the service redis client
+func (service *Service) RedisEventBroker(opt *events.RedisOptions) (*events.RedisBroker, error) {
+	if service.redisClient == nil {
+		return nil, errors.New("redis event broker requires a redis client")
+	}
+	return events.NewRedisBroker(service.redisClient, service.logger.With("component", "event broker"), opt)
+}
+
+// StartEventRelay publishes the events of outbox with publisher until the service context is done
+func (service *Service) StartEventRelay(
+	outbox *events.Outbox, publisher events.Publisher, opt *events.RelayOptions,
+) error {
+	relay, err := events.NewRelay(outbox, publisher, service.logger.With("component", "event relay"), opt)
+	if err != nil {
+		return errors.Wrap(err, "failed to create event relay")
+	}
+	go relay.Run(service.ctx)
+	return nil
+}
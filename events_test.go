@@ -0,0 +1,43 @@
+package micros
+
+import (
+	"database/sql"
+	"github.com/gidyon/micros/pkg/scheduler"
+	"strings"
+	"testing"
+)
+
+func TestSQLFeaturesRequireMySQL(t *testing.T) {
+	tests := []struct {
+		dialect string
+		wantErr bool
+	}{
+		{dialect: ""},
+		{dialect: "mysql"},
+		{dialect: "MySQL"},
+		{dialect: "postgres", wantErr: true},
+		{dialect: "sqlite3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			service := &Service{sqlDB: &sql.DB{}, sqlDialect: tt.dialect}
+			if err := service.requireMySQL("feature"); (err != nil) != tt.wantErr {
+				t.Errorf("requireMySQL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+
+			if _, err := service.EventOutbox(); err == nil || !strings.Contains(err.Error(), tt.dialect) {
+				t.Errorf("EventOutbox() error = %v, want dialect error", err)
+			}
+			if err := service.EnableIdempotency(nil); err == nil || !strings.Contains(err.Error(), tt.dialect) {
+				t.Errorf("EnableIdempotency() error = %v, want dialect error", err)
+			}
+			err := service.ScheduleWithOptions("cleanup", "@hourly", nil, &scheduler.JobOptions{SingleInstance: true})
+			if err == nil || !strings.Contains(err.Error(), tt.dialect) {
+				t.Errorf("ScheduleWithOptions() error = %v, want dialect error", err)
+			}
+		})
+	}
+}
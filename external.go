@@ -0,0 +1,338 @@
+package micros
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/conn"
+	"github.com/gidyon/micros/pkg/requestid"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// externalService holds the dial options and lazily created connection of an external service
+type externalService struct {
+	lastUsed int64 // unix nanoseconds, accessed atomically; first for 64-bit alignment
+	active   int64 // calls and streams in flight, accessed atomically
+	options  *conn.GRPCDialOptions
+	cc       *grpc.ClientConn
+	breaker  *conn.CircuitBreaker
+}
+
+// ExternalServiceInfo describes an external service and the state of its connection
+type ExternalServiceInfo struct {
+	Name      string
+	Address   string
+	Connected bool
+	// State is the gRPC connectivity state of the connection e.g READY or TRANSIENT_FAILURE
+	State        string
+	LastUsed     time.Time
+	CircuitState string
+}
+
+func (extSrv *externalService) touch() {
+	atomic.StoreInt64(&extSrv.lastUsed, time.Now().UnixNano())
+}
+
+// idle reports whether the connection has no calls in flight and has not been used for idleTimeout
+func (extSrv *externalService) idle(idleTimeout time.Duration) bool {
+	if atomic.LoadInt64(&extSrv.active) > 0 {
+		return false
+	}
+	lastUsed := time.Unix(0, atomic.LoadInt64(&extSrv.lastUsed))
+	return time.Since(lastUsed) >= idleTimeout
+}
+
+// usageInterceptor records calls in flight and when the connection was last used so idle connections
+// can be closed
+func (extSrv *externalService) usageInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	extSrv.touch()
+	atomic.AddInt64(&extSrv.active, 1)
+	defer func() {
+		atomic.AddInt64(&extSrv.active, -1)
+		extSrv.touch()
+	}()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (extSrv *externalService) usageStreamInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	extSrv.touch()
+	atomic.AddInt64(&extSrv.active, 1)
+
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		atomic.AddInt64(&extSrv.active, -1)
+		return nil, err
+	}
+
+	tracked := &trackedStream{ClientStream: stream, desc: desc, finished: make(chan struct{})}
+	tracked.finish = func() {
+		tracked.once.Do(func() {
+			close(tracked.finished)
+			atomic.AddInt64(&extSrv.active, -1)
+			extSrv.touch()
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			tracked.finish()
+		case <-tracked.finished:
+		}
+	}()
+
+	return tracked, nil
+}
+
+// trackedStream calls finish once the stream is over: when receiving fails, e.g with io.EOF, when the
+// single response of a client stream is received or when the stream context is done
+type trackedStream struct {
+	grpc.ClientStream
+	desc     *grpc.StreamDesc
+	once     sync.Once
+	finished chan struct{}
+	finish   func()
+}
+
+func (s *trackedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil || !s.desc.ServerStreams {
+		s.finish()
+	}
+	return err
+}
+
+// RegisterExternalService adds an external service at runtime. The service is connected to on first use.
+// Services without a policy use the one set for them in the service options, if any
+func (service *Service) RegisterExternalService(opt *conn.GRPCDialOptions) error {
+	if opt == nil || strings.TrimSpace(opt.ServiceName) == "" {
+		return errors.New("external service must have a name")
+	}
+
+	key := strings.ToLower(opt.ServiceName)
+
+	service.externalServicesMu.Lock()
+	defer service.externalServicesMu.Unlock()
+
+	if _, ok := service.externalServices[key]; ok {
+		return errors.Errorf("service with name %s already exists", opt.ServiceName)
+	}
+
+	if policy, ok := service.externalServicePolicies[key]; ok && opt.Policy == nil {
+		options := *opt
+		options.Policy = policy
+		opt = &options
+	}
+
+	extSrv := &externalService{options: opt}
+	if opt.Policy != nil && opt.Policy.CircuitBreaker != nil && opt.CircuitBreaker == nil {
+		extSrv.breaker = service.newCircuitBreaker(opt.ServiceName, opt.Policy.CircuitBreaker)
+	} else {
+		extSrv.breaker = opt.CircuitBreaker
+	}
+
+	service.externalServices[key] = extSrv
+
+	return nil
+}
+
+// ExternalServiceConn returns the underlying grpc connection to the external service,
+// connecting to the service if this is the first use. When an idle timeout is set, connections
+// with calls or streams in flight are kept open, but callers should get the connection for each
+// call instead of holding on to it for longer than the idle timeout
+func (service *Service) ExternalServiceConn(serviceName string) (*grpc.ClientConn, error) {
+	key := strings.ToLower(serviceName)
+
+	service.externalServicesMu.RLock()
+	extSrv, ok := service.externalServices[key]
+	if ok && extSrv.cc != nil {
+		// touched while holding the lock so the reaper cannot close the connection being returned
+		extSrv.touch()
+		cc := extSrv.cc
+		service.externalServicesMu.RUnlock()
+		return cc, nil
+	}
+	service.externalServicesMu.RUnlock()
+
+	if !ok {
+		return nil, errors.Errorf("no service exists with name: %s", serviceName)
+	}
+
+	service.externalServicesMu.Lock()
+	defer service.externalServicesMu.Unlock()
+
+	// The service may have been connected or removed while waiting for the lock
+	extSrv, ok = service.externalServices[key]
+	if !ok {
+		return nil, errors.Errorf("no service exists with name: %s", serviceName)
+	}
+	if extSrv.cc != nil {
+		extSrv.touch()
+		return extSrv.cc, nil
+	}
+
+	dialOptions := *extSrv.options
+	dialOptions.CircuitBreaker = extSrv.breaker
+	if dialOptions.Logger == nil {
+		dialOptions.Logger = service.logger
+	}
+	dialOptions.DialOptions = append(
+		append([]grpc.DialOption{}, dialOptions.DialOptions...),
+		grpc.WithChainUnaryInterceptor(extSrv.usageInterceptor, requestid.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(extSrv.usageStreamInterceptor, requestid.StreamClientInterceptor()),
+	)
+
+	cc, err := conn.DialService(context.Background(), &dialOptions)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create connection to service %s", serviceName)
+	}
+
+	extSrv.cc = cc
+	extSrv.touch()
+
+	return cc, nil
+}
+
+// SetExternalServicePolicy sets deadlines, retries, hedging and circuit breaking for calls to an
+// external service. An open connection to the service is closed and reopened with the policy on next use
+func (service *Service) SetExternalServicePolicy(serviceName string, policy *conn.CallPolicy) error {
+	service.externalServicesMu.Lock()
+	defer service.externalServicesMu.Unlock()
+
+	extSrv, ok := service.externalServices[strings.ToLower(serviceName)]
+	if !ok {
+		return errors.Errorf("no service exists with name: %s", serviceName)
+	}
+
+	options := *extSrv.options
+	options.Policy = policy
+	extSrv.options = &options
+
+	extSrv.breaker = nil
+	if policy != nil && policy.CircuitBreaker != nil {
+		extSrv.breaker = service.newCircuitBreaker(options.ServiceName, policy.CircuitBreaker)
+	}
+
+	if extSrv.cc != nil {
+		extSrv.cc.Close()
+		extSrv.cc = nil
+	}
+
+	return nil
+}
+
+// SetExternalServicesIdleTimeout closes connections to external services that have no calls or streams
+// in flight and have not been used for the given duration. They are reconnected on next use. A zero
+// duration keeps connections open
+func (service *Service) SetExternalServicesIdleTimeout(idleTimeout time.Duration) {
+	service.externalServicesMu.Lock()
+	defer service.externalServicesMu.Unlock()
+
+	service.externalIdleTimeout = idleTimeout
+
+	if idleTimeout > 0 && !service.externalReaperStarted {
+		service.externalReaperStarted = true
+		go service.closeIdleExternalServices()
+	}
+}
+
+// closeIdleExternalServices periodically closes idle connections until the service context is done
+func (service *Service) closeIdleExternalServices() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-service.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		service.externalServicesMu.Lock()
+		idleTimeout := service.externalIdleTimeout
+		for _, extSrv := range service.externalServices {
+			if idleTimeout <= 0 || extSrv.cc == nil {
+				continue
+			}
+			if extSrv.idle(idleTimeout) {
+				extSrv.cc.Close()
+				extSrv.cc = nil
+			}
+		}
+		service.externalServicesMu.Unlock()
+	}
+}
+
+// newCircuitBreaker creates a circuit breaker that logs its state changes
+func (service *Service) newCircuitBreaker(name string, opt *conn.CircuitBreakerOptions) *conn.CircuitBreaker {
+	options := *opt
+	onStateChange := opt.OnStateChange
+	options.OnStateChange = func(name string, from, to conn.CircuitState) {
+		service.logger.Warn("circuit breaker changed state", "service", name, "from", from.String(), "to", to.String())
+		if onStateChange != nil {
+			onStateChange(name, from, to)
+		}
+	}
+	return conn.NewCircuitBreaker(name, &options)
+}
+
+// CircuitBreaker returns the circuit breaker for calls to the external service or nil if it has none
+func (service *Service) CircuitBreaker(serviceName string) *conn.CircuitBreaker {
+	service.externalServicesMu.RLock()
+	defer service.externalServicesMu.RUnlock()
+
+	extSrv, ok := service.externalServices[strings.ToLower(serviceName)]
+	if !ok {
+		return nil
+	}
+	return extSrv.breaker
+}
+
+// ExternalServices lists the external services and the state of their connections
+func (service *Service) ExternalServices() []*ExternalServiceInfo {
+	service.externalServicesMu.RLock()
+	defer service.externalServicesMu.RUnlock()
+
+	infos := make([]*ExternalServiceInfo, 0, len(service.externalServices))
+	for _, extSrv := range service.externalServices {
+		info := &ExternalServiceInfo{
+			Name:      extSrv.options.ServiceName,
+			Address:   extSrv.options.Address,
+			Connected: extSrv.cc != nil,
+			State:     "NOT_CONNECTED",
+		}
+		if extSrv.cc != nil {
+			info.State = extSrv.cc.GetState().String()
+		}
+		if lastUsed := atomic.LoadInt64(&extSrv.lastUsed); lastUsed > 0 {
+			info.LastUsed = time.Unix(0, lastUsed)
+		}
+		if extSrv.breaker != nil {
+			info.CircuitState = extSrv.breaker.State().String()
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
@@ -0,0 +1,66 @@
+package micros
+
+import (
+	"context"
+	"github.com/gidyon/micros/internal/testutil"
+	"google.golang.org/grpc"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeClientStream returns err from RecvMsg
+type fakeClientStream struct {
+	grpc.ClientStream
+	err error
+}
+
+func (s *fakeClientStream) RecvMsg(interface{}) error {
+	return s.err
+}
+
+func TestExternalServiceIdle(t *testing.T) {
+	extSrv := &externalService{}
+	fake := &fakeClientStream{}
+	streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+		return fake, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := extSrv.usageStreamInterceptor(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, "/svc/Watch", streamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an open stream keeps the connection busy however long it lasts
+	if extSrv.idle(0) {
+		t.Fatal("connection with an open stream is idle")
+	}
+	if err := stream.RecvMsg(nil); err != nil {
+		t.Fatal(err)
+	}
+	if extSrv.idle(0) {
+		t.Fatal("connection is idle after receiving a message")
+	}
+
+	fake.err = io.EOF
+	stream.RecvMsg(nil)
+	if !extSrv.idle(0) {
+		t.Error("connection is not idle once the stream ended")
+	}
+	if extSrv.idle(time.Minute) {
+		t.Error("connection is idle right after the stream ended")
+	}
+
+	// streams that are abandoned end with their context
+	stream, err = extSrv.usageStreamInterceptor(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, "/svc/Watch", streamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	testutil.WaitFor(t, "the connection to be idle after the stream context was cancelled", func() bool {
+		return extSrv.idle(0)
+	})
+}
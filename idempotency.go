@@ -0,0 +1,52 @@
+package micros
+
+import (
+	"github.com/gidyon/micros/pkg/idempotency"
+	"github.com/pkg/errors"
+)
+
+// EnableIdempotency makes retried calls to the methods in opt idempotent using the Idempotency-Key header
+// or idempotency-key metadata. Records are kept in opt.Store, or else in the service redis client or
+// MySQL database in that order. It must be called before InitGRPC and RuntimeMux
+func (service *Service) EnableIdempotency(opt *idempotency.Options) error {
+	if err := service.checkRuntimeMuxOptions(); err != nil {
+		return errors.Wrap(err, "failed to enable idempotency")
+	}
+	if opt == nil {
+		opt = &idempotency.Options{}
+	}
+	withStore := *opt
+
+	if withStore.Store == nil {
+		switch {
+		case service.redisClient != nil:
+			withStore.Store = idempotency.NewRedisStore(service.redisClient, "")
+		case service.sqlDB != nil:
+			if err := service.requireMySQL("idempotency SQL store"); err != nil {
+				return err
+			}
+			store, err := idempotency.NewSQLStore(service.sqlDB, "")
+			if err != nil {
+				return err
+			}
+			if err := store.CreateTable(service.ctx); err != nil {
+				return err
+			}
+			withStore.Store = store
+		default:
+			return errors.New("idempotency requires a store, a redis client or a SQL database")
+		}
+	}
+
+	interceptor, err := idempotency.UnaryServerInterceptor(&withStore)
+	if err != nil {
+		return errors.Wrap(err, "failed to create idempotency interceptor")
+	}
+
+	if err := service.addGatewayMetadata(idempotency.GatewayMetadata); err != nil {
+		return errors.Wrap(err, "failed to enable idempotency")
+	}
+	service.AddGRPCUnaryServerInterceptors(interceptor)
+
+	return nil
+}
@@ -0,0 +1,19 @@
+// Package testutil contains helpers shared by the tests of micros packages
+package testutil
+
+import (
+	"testing"
+	"time"
+)
+
+// WaitFor polls cond every 10ms until it holds, failing the test when it does not hold within 5 seconds
+func WaitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
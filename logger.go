@@ -0,0 +1,34 @@
+package micros
+
+import (
+	"github.com/gidyon/logger"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Logger is the structured logger used by the service. Adapters for zap, logrus and slog and a no-op
+// logger for tests are in the logging package
+type Logger = logging.Logger
+
+// defaultLogger returns the zap logger configured by cfg or an info level zap logger when logging is disabled
+func defaultLogger(cfg interface{ Logging() bool }) (Logger, error) {
+	if cfg.Logging() {
+		return logging.NewZap(logger.Log), nil
+	}
+	zapLogger, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create default logger")
+	}
+	return logging.NewZap(zapLogger), nil
+}
+
+// SetLogger replaces the logger used by the service and the packages it configures
+func (service *Service) SetLogger(logger Logger) {
+	service.logger = logging.OrNop(logger)
+}
+
+// Logger returns the logger of the service
+func (service *Service) Logger() Logger {
+	return service.logger
+}
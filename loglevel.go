@@ -0,0 +1,38 @@
+package micros
+
+import (
+	"github.com/gidyon/micros/pkg/loglevel"
+	"github.com/pkg/errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// LogLevel returns the controller of the service logger level or nil when logging is disabled.
+// Loggers used with the gRPC logging interceptors should be wrapped with its WrapLogger to allow
+// changing the level of single methods
+func (service *Service) LogLevel() *loglevel.Controller {
+	return service.logLevel
+}
+
+// RegisterLogLevelAdmin serves the log level admin endpoint at path and registers the log level admin
+// gRPC service. The endpoints are not authenticated so path should only be reachable by operators.
+// InitGRPC must have been called
+func (service *Service) RegisterLogLevelAdmin(path string) error {
+	switch {
+	case service.logLevel == nil:
+		return errors.New("logging is disabled")
+	case service.gRPCServer == nil:
+		return errors.New("InitGRPC must be called before registering log level admin")
+	case atomic.LoadInt32(&service.running) == 1:
+		return errors.New("cannot register log level admin after service has started running")
+	}
+
+	if service.httpMux == nil {
+		service.httpMux = http.NewServeMux()
+	}
+	service.httpMux.Handle(path, service.logLevel)
+
+	loglevel.RegisterAdminServer(service.gRPCServer, service.logLevel)
+
+	return nil
+}
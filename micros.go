@@ -9,39 +9,66 @@ import (
 	"github.com/gidyon/logger"
 	"github.com/gidyon/micros/pkg/conn"
 	http_middleware "github.com/gidyon/micros/pkg/http"
+	"github.com/gidyon/micros/pkg/loglevel"
+	"github.com/gidyon/micros/pkg/pubsub"
+	"github.com/gidyon/micros/pkg/scheduler"
 	microtls "github.com/gidyon/micros/utils/tls"
 	"github.com/go-redis/redis"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
 	"strings"
+	"sync"
+	"time"
 
 	"net/http"
 
 	"google.golang.org/grpc"
-
-	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 )
 
 // Service contains API clients, connections and options for bootstrapping a micro-service
 type Service struct {
+	ctx                          context.Context
+	running                      int32 // set atomically once Run is called
 	cfg                          *config.Config
+	logLevel                     *loglevel.Controller
+	logger                       Logger
 	db                           *gorm.DB // uses gorm
 	sqlDB                        *sql.DB  // uses database/sql driver
+	sqlDialect                   string
 	redisClient                  *redis.Client
 	rediSearchClient             *redisearch.Client
 	baseEndpoint                 string
+	openAPIPatterns              []string
 	httpMiddlewares              []http_middleware.Middleware
+	corsOptions                  *http_middleware.CORSOptions
+	accessLogOptions             *http_middleware.AccessLogOptions
+	recoveryEnabled              bool
+	recoveryHooks                []PanicHook
+	grpcWebEnabled               bool
+	grpcWebOptions               []grpcweb.Option
 	httpMux                      *http.ServeMux
-	runtimeMux                   *runtime.ServeMux
+	httpServerOptions            *HTTPServerOptions
+	gateway                      gatewayMux
 	clientConn                   *grpc.ClientConn
 	gRPCServer                   *grpc.Server
-	externalServicesConn         map[string]*grpc.ClientConn
+	externalServicesMu           sync.RWMutex
+	externalServicePolicies      map[string]*conn.CallPolicy
+	externalServices             map[string]*externalService
+	externalIdleTimeout          time.Duration
+	externalReaperStarted        bool
 	serverOptions                []grpc.ServerOption
 	gRPCUnaryInterceptors        []grpc.UnaryServerInterceptor
 	gRPCStreamInterceptors       []grpc.StreamServerInterceptor
 	dialOptions                  []grpc.DialOption
 	gRPCUnaryClientInterceptors  []grpc.UnaryClientInterceptor
 	grpcStreamClientInterceptors []grpc.StreamClientInterceptor
+	autocertOptions              *microtls.AutocertOptions
+	background                   background
+	scheduler                    *scheduler.Scheduler
+	pubsubOnce                   sync.Once
+	pubsubBroker                 pubsub.Broker
+	pubsubErr                    error
 }
 
 // NewService create a new micro-service based on the options passed in config
@@ -50,25 +77,37 @@ func NewService(ctx context.Context, cfg *config.Config) (*Service, error) {
 	// Initialize paths to cert and key
 	microtls.SetKeyAndCertPaths(cfg.ServiceTLSKeyFile(), cfg.ServiceTLSCertFile())
 
+	var logLevel *loglevel.Controller
+
 	if cfg.Logging() {
 		// Initialize logger
 		err := logger.Init(cfg.LogLevel(), cfg.LogTimeFormat())
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to initialize logger")
 		}
+
+		// Allow changing the log level at runtime
+		logLevel = loglevel.NewController(loglevel.LevelOf(logger.Log.Core()))
+		logger.Log = logLevel.WrapLogger(logger.Log)
+	}
+
+	serviceLogger, err := defaultLogger(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	var (
-		err              error
 		db               *gorm.DB
 		sqlDB            *sql.DB
+		sqlDialect       string
 		redisClient      *redis.Client
 		rediSearchClient *redisearch.Client
-		externalServices = make(map[string]*grpc.ClientConn)
+		externalServices = make(map[string]*externalService)
 	)
 
 	if cfg.UseSQLDatabase() {
 		sqlDBInfo := cfg.SQLDatabase()
+		sqlDialect = sqlDBInfo.SQLDatabaseDialect()
 		if sqlDBInfo.UseGorm() {
 			// Create a *sql.DB instance
 			db, err = conn.ToSQLDBUsingORM(&conn.DBOptions{
@@ -117,33 +156,35 @@ func NewService(ctx context.Context, cfg *config.Config) (*Service, error) {
 		}
 	}
 
-	// Remote services
+	// Remote services are connected to lazily on first use
 	for _, srv := range cfg.ExternalServices() {
 		if !srv.Available() {
 			continue
 		}
-		externalServices[strings.ToLower(srv.Name())], err = conn.DialService(ctx, &conn.GRPCDialOptions{
-			ServiceName: srv.Name(),
-			Address:     srv.Address(),
-			TLSCertFile: srv.TLSCertFile(),
-			ServerName:  srv.ServerName(),
-			WithBlock:   false,
-			K8Service:   srv.K8Service(),
-		})
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to create connection to service %s", srv.Name())
+		externalServices[strings.ToLower(srv.Name())] = &externalService{
+			options: &conn.GRPCDialOptions{
+				ServiceName: srv.Name(),
+				Address:     srv.Address(),
+				TLSCertFile: srv.TLSCertFile(),
+				ServerName:  srv.ServerName(),
+				WithBlock:   false,
+				K8Service:   srv.K8Service(),
+			},
 		}
 	}
 
 	return &Service{
+		ctx:                          ctx,
 		cfg:                          cfg,
+		logLevel:                     logLevel,
+		logger:                       serviceLogger,
 		db:                           db,
 		sqlDB:                        sqlDB,
+		sqlDialect:                   sqlDialect,
 		redisClient:                  redisClient,
 		rediSearchClient:             rediSearchClient,
 		httpMiddlewares:              make([]http_middleware.Middleware, 0),
-		runtimeMux:                   newRuntimeMux(),
-		externalServicesConn:         externalServices,
+		externalServices:             externalServices,
 		gRPCUnaryInterceptors:        make([]grpc.UnaryServerInterceptor, 0),
 		gRPCStreamInterceptors:       make([]grpc.StreamServerInterceptor, 0),
 		serverOptions:                make([]grpc.ServerOption, 0),
@@ -168,6 +209,21 @@ func (service *Service) SetServiceEndpoint(path string) {
 	service.baseEndpoint = path
 }
 
+// UseDevCertificates makes the service fall back to an in-memory self-signed certificate when
+// the configured cert or key file is missing. It should only be used during development
+func (service *Service) UseDevCertificates(hosts ...string) {
+	if len(hosts) == 0 {
+		hosts = append([]string{service.cfg.ServiceName()}, microtls.DefaultHosts...)
+	}
+	microtls.SetDevMode(true, hosts...)
+}
+
+// UseAutocert makes the service obtain its TLS certificates from an ACME CA such as Let's Encrypt.
+// It has no effect when the service is run in insecure mode
+func (service *Service) UseAutocert(opt *microtls.AutocertOptions) {
+	service.autocertOptions = opt
+}
+
 // AddEndpoint binds a handler to the service at provided path
 func (service *Service) AddEndpoint(path string, handler http.Handler) {
 	if service.httpMux == nil {
@@ -189,6 +245,33 @@ func (service *Service) AddHTTPMiddlewares(middlewares ...http_middleware.Middle
 	service.httpMiddlewares = append(service.httpMiddlewares, middlewares...)
 }
 
+// SetCORSOptions enables CORS for all requests to the service using opt. Origins not allowed by opt
+// get no CORS headers. It replaces any CORS options set before
+func (service *Service) SetCORSOptions(opt *http_middleware.CORSOptions) error {
+	_, err := http_middleware.CORS(opt)
+	if err != nil {
+		return errors.Wrap(err, "failed to create CORS middleware")
+	}
+	service.corsOptions = opt
+	return nil
+}
+
+// EnableAccessLog logs every REST request handled by the service with the service logger.
+// gRPC calls are not logged since they are logged by the logging interceptors
+func (service *Service) EnableAccessLog(opt *http_middleware.AccessLogOptions) {
+	if opt == nil {
+		opt = &http_middleware.AccessLogOptions{}
+	}
+	service.accessLogOptions = opt
+}
+
+// EnableGRPCWeb lets browser clients call the gRPC services directly using gRPC-Web.
+// When CORS options are set, the gRPC-Web headers are allowed and exposed as well
+func (service *Service) EnableGRPCWeb(opts ...grpcweb.Option) {
+	service.grpcWebEnabled = true
+	service.grpcWebOptions = append(service.grpcWebOptions, opts...)
+}
+
 // AddGRPCDialOptions adds dial options to gRPC reverse proxy client
 func (service *Service) AddGRPCDialOptions(dialOptions ...grpc.DialOption) {
 	for _, dialOption := range dialOptions {
@@ -252,11 +335,6 @@ func (service *Service) Config() *config.Config {
 	return service.cfg
 }
 
-// RuntimeMux returns the runtime muxer for the service
-func (service *Service) RuntimeMux() *runtime.ServeMux {
-	return service.runtimeMux
-}
-
 // ClientConn returns the underlying client connection to grpc server used by reverse proxy
 func (service *Service) ClientConn() *grpc.ClientConn {
 	return service.clientConn
@@ -277,6 +355,15 @@ func (service *Service) SQLDB() *sql.DB {
 	return service.sqlDB
 }
 
+// requireMySQL returns an error when the service SQL database is not MySQL, which the tables and locks
+// of feature are written for
+func (service *Service) requireMySQL(feature string) error {
+	if dialect := strings.ToLower(service.sqlDialect); dialect != "" && dialect != "mysql" {
+		return errors.Errorf("%s supports only MySQL databases but the service database dialect is %s", feature, service.sqlDialect)
+	}
+	return nil
+}
+
 // RedisClient returns a redis client
 func (service *Service) RedisClient() *redis.Client {
 	return service.redisClient
@@ -286,25 +373,3 @@ func (service *Service) RedisClient() *redis.Client {
 func (service *Service) RediSearchClient() *redisearch.Client {
 	return service.rediSearchClient
 }
-
-// ExternalServiceConn returns the underlying grpc connection to the external service
-func (service *Service) ExternalServiceConn(serviceName string) (*grpc.ClientConn, error) {
-	cc, ok := service.externalServicesConn[strings.ToLower(serviceName)]
-	if !ok {
-		return nil, errors.Errorf("no service exists with name: %s", serviceName)
-	}
-	return cc, nil
-}
-
-// creates a http Muxer using runtime.NewServeMux
-func newRuntimeMux() *runtime.ServeMux {
-	return runtime.NewServeMux(
-		runtime.WithMarshalerOption(
-			runtime.MIMEWildcard,
-			&runtime.JSONPb{
-				OrigName:     true,
-				EmitDefaults: true,
-			},
-		),
-	)
-}
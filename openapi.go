@@ -0,0 +1,90 @@
+package micros
+
+import (
+	"github.com/gidyon/micros/pkg/openapi"
+	"github.com/pkg/errors"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// ServeOpenAPI merges the .swagger.json files in specFS and serves the document at path/swagger.json
+// with Swagger UI at path/. The document base path and port are set from the service endpoint and port,
+// so it should be called after SetServiceEndpoint. It fails when the UI would be served on the service endpoint,
+// as happens for path "/" with the default endpoint
+func (service *Service) ServeOpenAPI(path string, specFS fs.FS) error {
+	return service.ServeOpenAPIWithOptions(path, specFS, &openapi.Options{})
+}
+
+// ServeOpenAPIWithOptions is like ServeOpenAPI but allows choosing the UI, title, base path and port
+func (service *Service) ServeOpenAPIWithOptions(path string, specFS fs.FS, opt *openapi.Options) error {
+	if specFS == nil {
+		return errors.New("nil OpenAPI file system")
+	}
+
+	spec, err := openapi.Load(specFS)
+	if err != nil {
+		return errors.Wrap(err, "failed to load OpenAPI documents")
+	}
+
+	options := openapi.Options{}
+	if opt != nil {
+		options = *opt
+	}
+	if options.BasePath == "" {
+		options.BasePath = service.baseEndpoint
+	}
+	if options.Port == 0 {
+		options.Port = service.cfg.ServicePort()
+	}
+
+	prefix := strings.TrimSuffix("/"+strings.Trim(path, "/"), "/")
+	specURL := prefix + "/swagger.json"
+
+	patterns := []string{specURL}
+	if options.UI != openapi.NoUI {
+		patterns = append(patterns, prefix+"/")
+	}
+	for _, pattern := range patterns {
+		if err := service.checkOpenAPIPattern(pattern); err != nil {
+			return err
+		}
+	}
+
+	if service.httpMux == nil {
+		service.httpMux = http.NewServeMux()
+	}
+
+	service.httpMux.Handle(specURL, openapi.Handler(spec, &options))
+	if options.UI != openapi.NoUI {
+		service.httpMux.Handle(prefix+"/", openapi.UIHandler(options.UI, options.Title, specURL))
+	}
+	service.openAPIPatterns = append(service.openAPIPatterns, patterns...)
+
+	return nil
+}
+
+// checkOpenAPIPattern returns an error when pattern is the pattern the gateway is mounted on or one that
+// OpenAPI documents are already served on, since registering it twice on the mux panics
+func (service *Service) checkOpenAPIPattern(pattern string) error {
+	if pattern == service.gatewayPattern() {
+		return errors.Errorf(
+			"OpenAPI path %q clashes with the service endpoint %q; serve the documents under a sub-path such as /docs",
+			pattern, service.gatewayPattern(),
+		)
+	}
+	for _, existing := range service.openAPIPatterns {
+		if pattern == existing {
+			return errors.Errorf("OpenAPI documents are already served at %q", pattern)
+		}
+	}
+	return nil
+}
+
+// gatewayPattern is the pattern the gateway runtime mux is mounted on by Run
+func (service *Service) gatewayPattern() string {
+	if service.baseEndpoint == "" {
+		return "/"
+	}
+	return service.baseEndpoint
+}
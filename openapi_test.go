@@ -0,0 +1,39 @@
+package micros
+
+import (
+	"github.com/gidyon/micros/pkg/openapi"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServeOpenAPIPathClash(t *testing.T) {
+	specFS := fstest.MapFS{"api.swagger.json": {Data: []byte(`{"swagger": "2.0"}`)}}
+	opt := &openapi.Options{Port: 8080}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		paths    []string
+		wantErr  bool
+	}{
+		{name: "root with default endpoint", paths: []string{"/"}, wantErr: true},
+		{name: "sub-path with default endpoint", paths: []string{"/docs"}},
+		{name: "root with api endpoint", endpoint: "/api/", paths: []string{"/"}},
+		{name: "service endpoint", endpoint: "/api/", paths: []string{"/api"}, wantErr: true},
+		{name: "served twice", paths: []string{"/docs", "/docs/"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &Service{baseEndpoint: tt.endpoint}
+			var err error
+			for _, path := range tt.paths {
+				if err = service.ServeOpenAPIWithOptions(path, specFS, opt); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ServeOpenAPIWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
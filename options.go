@@ -0,0 +1,64 @@
+package micros
+
+import (
+	"github.com/gidyon/micros/pkg/conn"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"strings"
+)
+
+// ServiceOptions contains settings that complement config.Config. They are usually kept in a YAML or JSON
+// file next to the service config and read with LoadServiceOptions
+type ServiceOptions struct {
+	// HTTPServer contains the timeouts and limits of the HTTP server
+	HTTPServer *HTTPServerOptions `json:"httpServer" yaml:"httpServer"`
+	// ExternalServices contains the call policies of external services by service name
+	ExternalServices map[string]*conn.CallPolicy `json:"externalServices" yaml:"externalServices"`
+}
+
+// LoadServiceOptions reads service options from a YAML or JSON file. Durations are written as
+// strings e.g 5s and gRPC codes as names e.g UNAVAILABLE
+func LoadServiceOptions(path string) (*ServiceOptions, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read service options")
+	}
+	opt := &ServiceOptions{}
+	if err := yaml.UnmarshalStrict(data, opt); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse service options in %s", path)
+	}
+	return opt, nil
+}
+
+// ApplyOptions applies the settings in opt to the service. Policies of external services that are not
+// registered yet are applied when they are registered
+func (service *Service) ApplyOptions(opt *ServiceOptions) error {
+	if opt == nil {
+		return nil
+	}
+
+	if opt.HTTPServer != nil {
+		service.SetHTTPServerOptions(opt.HTTPServer)
+	}
+
+	for name, policy := range opt.ExternalServices {
+		key := strings.ToLower(name)
+
+		service.externalServicesMu.Lock()
+		if service.externalServicePolicies == nil {
+			service.externalServicePolicies = make(map[string]*conn.CallPolicy)
+		}
+		service.externalServicePolicies[key] = policy
+		_, registered := service.externalServices[key]
+		service.externalServicesMu.Unlock()
+
+		if registered {
+			if err := service.SetExternalServicePolicy(name, policy); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package conn
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets all calls through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails all calls fast with codes.Unavailable
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of trial calls through
+	CircuitHalfOpen
+)
+
+func (state CircuitState) String() string {
+	switch state {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerOptions contains options for a circuit breaker
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit; defaults to 5
+	FailureThreshold int `json:"failureThreshold" yaml:"failureThreshold"`
+	// OpenTimeout is how long the circuit stays open before trial calls are allowed; defaults to 30 seconds
+	OpenTimeout time.Duration `json:"openTimeout" yaml:"openTimeout"`
+	// HalfOpenMaxCalls is the number of concurrent trial calls in half-open state; defaults to 1
+	HalfOpenMaxCalls int `json:"halfOpenMaxCalls" yaml:"halfOpenMaxCalls"`
+	// FailureCodes are the codes counted as failures; defaults to Unavailable, DeadlineExceeded,
+	// ResourceExhausted and Internal
+	FailureCodes Codes `json:"failureCodes" yaml:"failureCodes"`
+	// OnStateChange is called whenever the circuit changes state e.g to update metrics
+	OnStateChange func(name string, from, to CircuitState) `json:"-" yaml:"-"`
+}
+
+var defaultFailureCodes = Codes{
+	codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal,
+}
+
+// CircuitBreaker fails calls to an unhealthy service fast instead of waiting for them to time out
+type CircuitBreaker struct {
+	name     string
+	opt      CircuitBreakerOptions
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	trials   int
+	// transitions are reported to OnStateChange once mu is released
+	transitions []transition
+}
+
+type transition struct {
+	from, to CircuitState
+}
+
+// NewCircuitBreaker creates a circuit breaker for the named service
+func NewCircuitBreaker(name string, opt *CircuitBreakerOptions) *CircuitBreaker {
+	cb := &CircuitBreaker{name: name}
+	if opt != nil {
+		cb.opt = *opt
+	}
+	if cb.opt.FailureThreshold <= 0 {
+		cb.opt.FailureThreshold = 5
+	}
+	if cb.opt.OpenTimeout <= 0 {
+		cb.opt.OpenTimeout = 30 * time.Second
+	}
+	if cb.opt.HalfOpenMaxCalls <= 0 {
+		cb.opt.HalfOpenMaxCalls = 1
+	}
+	if len(cb.opt.FailureCodes) == 0 {
+		cb.opt.FailureCodes = defaultFailureCodes
+	}
+	return cb
+}
+
+// Name returns the name of the service the circuit breaker protects
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+// State returns the current state of the circuit
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.unlock()
+	cb.expireOpen(time.Now())
+	return cb.state
+}
+
+// Allow returns an Unavailable error when the circuit does not allow calls
+func (cb *CircuitBreaker) Allow() error {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	cb.expireOpen(time.Now())
+
+	switch cb.state {
+	case CircuitOpen:
+		return status.Errorf(codes.Unavailable, "circuit breaker for %s service is open", cb.name)
+	case CircuitHalfOpen:
+		if cb.trials >= cb.opt.HalfOpenMaxCalls {
+			return status.Errorf(codes.Unavailable, "circuit breaker for %s service is half-open", cb.name)
+		}
+		cb.trials++
+	}
+
+	return nil
+}
+
+// Record records the result of a call allowed by the circuit breaker
+func (cb *CircuitBreaker) Record(err error) {
+	cb.mu.Lock()
+	defer cb.unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.trials--
+	}
+
+	if !cb.isFailure(err) {
+		cb.failures = 0
+		if cb.state == CircuitHalfOpen {
+			cb.setState(CircuitClosed)
+		}
+		return
+	}
+
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.opt.FailureThreshold {
+		cb.openedAt = time.Now()
+		cb.setState(CircuitOpen)
+	}
+}
+
+func (cb *CircuitBreaker) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	code := status.Code(err)
+	for _, failureCode := range cb.opt.FailureCodes {
+		if code == failureCode {
+			return true
+		}
+	}
+	return false
+}
+
+// expireOpen moves an open circuit to half-open once the open timeout has passed
+func (cb *CircuitBreaker) expireOpen(now time.Time) {
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.opt.OpenTimeout {
+		cb.trials = 0
+		cb.setState(CircuitHalfOpen)
+	}
+}
+
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	if cb.state == state {
+		return
+	}
+	if cb.opt.OnStateChange != nil {
+		cb.transitions = append(cb.transitions, transition{from: cb.state, to: state})
+	}
+	cb.state = state
+}
+
+// unlock releases cb.mu and then reports the transitions recorded while it was held, so that
+// OnStateChange may call back into the circuit breaker
+func (cb *CircuitBreaker) unlock() {
+	transitions := cb.transitions
+	cb.transitions = nil
+	cb.mu.Unlock()
+
+	for _, t := range transitions {
+		cb.opt.OnStateChange(cb.name, t.from, t.to)
+	}
+}
+
+// UnaryClientInterceptor returns a client interceptor that guards unary calls with the circuit breaker
+func (cb *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if err := cb.Allow(); err != nil {
+			return err
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		cb.Record(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a client interceptor that guards stream creation with the circuit breaker
+func (cb *CircuitBreaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		if err := cb.Allow(); err != nil {
+			return nil, err
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		cb.Record(err)
+		return stream, err
+	}
+}
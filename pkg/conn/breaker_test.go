@@ -0,0 +1,104 @@
+package conn
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	changes := make([]CircuitState, 0)
+	cb := NewCircuitBreaker("account", &CircuitBreakerOptions{
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+		OnStateChange: func(name string, from, to CircuitState) {
+			changes = append(changes, to)
+		},
+	})
+
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	// Errors that are not failures don't open the circuit
+	cb.Record(status.Error(codes.NotFound, "not found"))
+	cb.Record(status.Error(codes.NotFound, "not found"))
+	if cb.State() != CircuitClosed {
+		t.Fatalf("State() = %v, want %v", cb.State(), CircuitClosed)
+	}
+
+	cb.Record(unavailable)
+	cb.Record(unavailable)
+	if cb.State() != CircuitOpen {
+		t.Fatalf("State() = %v, want %v", cb.State(), CircuitOpen)
+	}
+
+	err := cb.Allow()
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Allow() error = %v, want code %v", err, codes.Unavailable)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	// One trial call is allowed when half-open
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("Allow() error = %v in half-open state", err)
+	}
+	if err := cb.Allow(); err == nil {
+		t.Fatalf("Allow() expected error for second trial call")
+	}
+
+	// A failed trial opens the circuit again
+	cb.Record(unavailable)
+	if cb.State() != CircuitOpen {
+		t.Fatalf("State() = %v, want %v", cb.State(), CircuitOpen)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	// A successful trial closes the circuit
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("Allow() error = %v in half-open state", err)
+	}
+	cb.Record(nil)
+	if cb.State() != CircuitClosed {
+		t.Fatalf("State() = %v, want %v", cb.State(), CircuitClosed)
+	}
+
+	want := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(changes) != len(want) {
+		t.Fatalf("state changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("state changes = %v, want %v", changes, want)
+			break
+		}
+	}
+}
+
+func TestCircuitBreakerStateChangeCallback(t *testing.T) {
+	var cb *CircuitBreaker
+	var states []CircuitState
+	cb = NewCircuitBreaker("account", &CircuitBreakerOptions{
+		FailureThreshold: 1,
+		OnStateChange: func(name string, from, to CircuitState) {
+			// the circuit breaker may be used from the callback
+			states = append(states, cb.State())
+		},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cb.Record(status.Error(codes.Unavailable, "down"))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnStateChange calling State deadlocked")
+	}
+	if len(states) != 1 || states[0] != CircuitOpen {
+		t.Errorf("states seen by callback = %v, want [%v]", states, CircuitOpen)
+	}
+}
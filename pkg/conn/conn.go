@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/gidyon/micros/pkg/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware"
 	"google.golang.org/grpc/balancer/roundrobin"
 
@@ -16,6 +17,9 @@ import (
 
 	// Imports mysql driver
 	_ "github.com/go-sql-driver/mysql"
+
+	// Registers static and srv resolvers
+	_ "github.com/gidyon/micros/pkg/discovery"
 )
 
 // DBOptions contains information for connecting to SQL database
@@ -122,6 +126,12 @@ type GRPCDialOptions struct {
 	WithBlock   bool
 	DialOptions []grpc.DialOption
 	K8Service   bool
+	// Policy controls deadlines, retries, hedging and circuit breaking; DefaultCallPolicy is used when nil
+	Policy *CallPolicy
+	// CircuitBreaker guards calls when the policy has circuit breaker options
+	CircuitBreaker *CircuitBreaker
+	// Logger logs dialing; logs are discarded when nil
+	Logger logging.Logger
 }
 
 // DialAccountService dials to authentication service and returns the grpc client connection
@@ -136,20 +146,33 @@ func DialNotificationService(ctx context.Context, opt *GRPCDialOptions) (*grpc.C
 
 // DialService dials to any remote service and returns the grpc client connection
 func DialService(ctx context.Context, opt *GRPCDialOptions) (*grpc.ClientConn, error) {
+	logger := logging.OrNop(opt.Logger).With("service", opt.ServiceName)
+
 	creds, err := credentials.NewClientTLSFromFile(opt.TLSCertFile, opt.ServerName)
 	if err != nil {
+		logger.Error("failed to create tls config", "error", err)
 		return nil, errors.Wrapf(err, "failed to create tls config for %s service", opt.ServerName)
 	}
 
+	policy := opt.Policy
+	if policy == nil {
+		policy = DefaultCallPolicy
+	}
+
 	dopts := []grpc.DialOption{
 		// Transport TLS
 		grpc.WithTransportCredentials(creds),
 		// Load balancer scheme
 		grpc.WithBalancerName(roundrobin.Name),
-		// Other interceptors
+		// Deadline, circuit breaker, retry and hedging interceptors
 		grpc.WithUnaryInterceptor(
 			grpc_middleware.ChainUnaryClient(
-				waitForReadyInterceptor,
+				policy.UnaryClientInterceptors(opt.CircuitBreaker)...,
+			),
+		),
+		grpc.WithStreamInterceptor(
+			grpc_middleware.ChainStreamClient(
+				policy.StreamClientInterceptors(opt.CircuitBreaker)...,
 			),
 		),
 	}
@@ -162,23 +185,19 @@ func DialService(ctx context.Context, opt *GRPCDialOptions) (*grpc.ClientConn, e
 		dopts = append(dopts, opt.DialOptions...)
 	}
 
-	// Address for dialing the kubernetes service
-	if opt.K8Service {
-		opt.Address = strings.TrimSuffix(opt.Address, "dns:///")
+	// Address for dialing the kubernetes service. Addresses with a resolver scheme
+	// e.g static:///, srv:/// or kubernetes:/// are left to their resolver
+	if opt.K8Service && !strings.Contains(opt.Address, ":///") {
 		opt.Address = "dns:///" + opt.Address
 	}
 
-	return grpc.DialContext(ctx, opt.Address, dopts...)
-}
+	logger.Debug("dialing service", "address", opt.Address)
+
+	cc, err := grpc.DialContext(ctx, opt.Address, dopts...)
+	if err != nil {
+		logger.Error("failed to dial service", "address", opt.Address, "error", err)
+		return nil, err
+	}
 
-// wait for ready call option for all client call
-func waitForReadyInterceptor(
-	ctx context.Context,
-	method string,
-	req, reply interface{},
-	cc *grpc.ClientConn,
-	invoker grpc.UnaryInvoker,
-	opts ...grpc.CallOption,
-) error {
-	return invoker(ctx, method, req, reply, cc, grpc.WaitForReady(true))
+	return cc, nil
 }
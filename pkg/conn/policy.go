@@ -0,0 +1,302 @@
+package conn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CallPolicy contains options that control how calls to an external service behave when it is slow or down
+type CallPolicy struct {
+	// Timeout is the deadline applied to unary calls that don't have one
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// WaitForReady makes calls wait for the connection to be ready instead of failing fast
+	WaitForReady bool `json:"waitForReady" yaml:"waitForReady"`
+	// Retry retries failed unary and server streaming calls. Takes precedence over Hedging
+	Retry *RetryPolicy `json:"retry" yaml:"retry"`
+	// Hedging sends extra copies of slow unary calls and uses the first successful response
+	Hedging *HedgingPolicy `json:"hedging" yaml:"hedging"`
+	// CircuitBreaker fails calls fast while the service is unhealthy
+	CircuitBreaker *CircuitBreakerOptions `json:"circuitBreaker" yaml:"circuitBreaker"`
+}
+
+// RetryPolicy contains options for retrying calls
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first call; defaults to 3
+	MaxAttempts uint `json:"maxAttempts" yaml:"maxAttempts"`
+	// Codes are the codes that are retried; defaults to Unavailable and ResourceExhausted
+	Codes Codes `json:"codes" yaml:"codes"`
+	// Backoff is the base of the exponential backoff between attempts; defaults to 100ms
+	Backoff time.Duration `json:"backoff" yaml:"backoff"`
+	// PerAttemptTimeout is the deadline for each attempt
+	PerAttemptTimeout time.Duration `json:"perAttemptTimeout" yaml:"perAttemptTimeout"`
+}
+
+// HedgingPolicy contains options for hedging calls
+type HedgingPolicy struct {
+	// MaxAttempts is the total number of calls that can be in flight; defaults to 2
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	// Delay is how long to wait for a response before sending the next call
+	Delay time.Duration `json:"delay" yaml:"delay"`
+	// NonFatalCodes are codes that trigger the next call immediately instead of failing the call
+	NonFatalCodes Codes `json:"nonFatalCodes" yaml:"nonFatalCodes"`
+}
+
+// Codes is a list of gRPC codes. In JSON and YAML codes are written as names e.g UNAVAILABLE or numbers
+type Codes []codes.Code
+
+// UnmarshalJSON reads codes written as names or numbers
+func (c *Codes) UnmarshalJSON(data []byte) error {
+	var values []interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return errors.Wrap(err, "codes must be a list")
+	}
+	return c.set(values)
+}
+
+// UnmarshalYAML reads codes written as names or numbers
+func (c *Codes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var values []interface{}
+	if err := unmarshal(&values); err != nil {
+		return errors.Wrap(err, "codes must be a list")
+	}
+	return c.set(values)
+}
+
+func (c *Codes) set(values []interface{}) error {
+	list := make(Codes, 0, len(values))
+	for _, value := range values {
+		text := strings.ToUpper(fmt.Sprint(value))
+		if _, err := strconv.ParseUint(text, 10, 32); err != nil {
+			text = strconv.Quote(text)
+		}
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(text)); err != nil {
+			return errors.Errorf("invalid gRPC code %v", value)
+		}
+		list = append(list, code)
+	}
+	*c = list
+	return nil
+}
+
+// DefaultCallPolicy is used for services dialed without a policy.
+// Calls wait for the connection to be ready but never longer than the timeout
+var DefaultCallPolicy = &CallPolicy{
+	Timeout:      10 * time.Second,
+	WaitForReady: true,
+}
+
+// UnaryClientInterceptors returns the unary client interceptors that apply the policy in order.
+// cb may be nil when the policy has no circuit breaker
+func (policy *CallPolicy) UnaryClientInterceptors(cb *CircuitBreaker) []grpc.UnaryClientInterceptor {
+	interceptors := make([]grpc.UnaryClientInterceptor, 0)
+
+	if policy.Timeout > 0 {
+		interceptors = append(interceptors, timeoutInterceptor(policy.Timeout))
+	}
+
+	if cb != nil {
+		interceptors = append(interceptors, cb.UnaryClientInterceptor())
+	}
+
+	switch {
+	case policy.Retry != nil:
+		interceptors = append(interceptors, grpc_retry.UnaryClientInterceptor(policy.Retry.callOptions()...))
+	case policy.Hedging != nil:
+		interceptors = append(interceptors, hedgingInterceptor(policy.Hedging))
+	}
+
+	if policy.WaitForReady {
+		interceptors = append(interceptors, waitForReadyInterceptor)
+	}
+
+	return interceptors
+}
+
+// StreamClientInterceptors returns the stream client interceptors that apply the policy in order.
+// Streams are long lived so they are not given a default deadline
+func (policy *CallPolicy) StreamClientInterceptors(cb *CircuitBreaker) []grpc.StreamClientInterceptor {
+	interceptors := make([]grpc.StreamClientInterceptor, 0)
+
+	if cb != nil {
+		interceptors = append(interceptors, cb.StreamClientInterceptor())
+	}
+
+	if policy.Retry != nil {
+		interceptors = append(interceptors, grpc_retry.StreamClientInterceptor(policy.Retry.callOptions()...))
+	}
+
+	if policy.WaitForReady {
+		interceptors = append(interceptors, waitForReadyStreamInterceptor)
+	}
+
+	return interceptors
+}
+
+func (retry *RetryPolicy) callOptions() []grpc_retry.CallOption {
+	maxAttempts := retry.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 3
+	}
+	retryCodes := retry.Codes
+	if len(retryCodes) == 0 {
+		retryCodes = Codes{codes.Unavailable, codes.ResourceExhausted}
+	}
+	backoff := retry.Backoff
+	if backoff == 0 {
+		backoff = 100 * time.Millisecond
+	}
+
+	opts := []grpc_retry.CallOption{
+		grpc_retry.WithMax(maxAttempts),
+		grpc_retry.WithCodes(retryCodes...),
+		grpc_retry.WithBackoff(grpc_retry.BackoffExponentialWithJitter(backoff, 0.2)),
+	}
+
+	if retry.PerAttemptTimeout > 0 {
+		opts = append(opts, grpc_retry.WithPerRetryTimeout(retry.PerAttemptTimeout))
+	}
+
+	return opts
+}
+
+// timeoutInterceptor sets a deadline on calls that don't have one
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// hedgingInterceptor sends a new call each time the delay passes without a response, up to max attempts.
+// The first successful response is used and the other calls are cancelled
+func hedgingInterceptor(policy *HedgingPolicy) grpc.UnaryClientInterceptor {
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 2
+	}
+
+	nonFatal := func(err error) bool {
+		code := status.Code(err)
+		for _, nonFatalCode := range policy.NonFatalCodes {
+			if code == nonFatalCode {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		replyMsg, ok := reply.(proto.Message)
+		if !ok || maxAttempts < 2 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type result struct {
+			reply proto.Message
+			err   error
+		}
+
+		results := make(chan result, maxAttempts)
+		sent, pending := 0, 0
+
+		send := func() {
+			sent++
+			pending++
+			go func() {
+				// Each attempt needs its own reply since calls complete concurrently
+				attemptReply := proto.Clone(replyMsg)
+				attemptReply.Reset()
+				err := invoker(ctx, method, req, attemptReply, cc, opts...)
+				results <- result{reply: attemptReply, err: err}
+			}()
+		}
+
+		timer := time.NewTimer(policy.Delay)
+		defer timer.Stop()
+
+		send()
+
+		var lastErr error
+		for pending > 0 {
+			select {
+			case <-timer.C:
+				if sent < maxAttempts {
+					send()
+					timer.Reset(policy.Delay)
+				}
+			case res := <-results:
+				pending--
+				if res.err == nil {
+					replyMsg.Reset()
+					proto.Merge(replyMsg, res.reply)
+					return nil
+				}
+				lastErr = res.err
+				if !nonFatal(res.err) {
+					return res.err
+				}
+				if sent < maxAttempts {
+					send()
+				}
+			}
+		}
+
+		return lastErr
+	}
+}
+
+// wait for ready call option for all client call
+func waitForReadyInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	return invoker(ctx, method, req, reply, cc, append([]grpc.CallOption{grpc.WaitForReady(true)}, opts...)...)
+}
+
+// wait for ready call option for all client streams
+func waitForReadyStreamInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	return streamer(ctx, desc, cc, method, append([]grpc.CallOption{grpc.WaitForReady(true)}, opts...)...)
+}
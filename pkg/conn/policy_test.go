@@ -0,0 +1,111 @@
+package conn
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgingInterceptor(t *testing.T) {
+	var calls int32
+
+	// The first call hangs so the hedged call must answer
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		reply.(*wrappers.StringValue).Value = "hedged"
+		return nil
+	}
+
+	interceptor := hedgingInterceptor(&HedgingPolicy{MaxAttempts: 2, Delay: 10 * time.Millisecond})
+
+	reply := &wrappers.StringValue{}
+	err := interceptor(context.Background(), "/svc/Method", &wrappers.StringValue{}, reply, nil, invoker)
+	if err != nil {
+		t.Fatalf("interceptor error = %v", err)
+	}
+	if reply.Value != "hedged" {
+		t.Errorf("reply = %q, want %q", reply.Value, "hedged")
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
+
+func TestTimeoutInterceptor(t *testing.T) {
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		<-ctx.Done()
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	interceptor := timeoutInterceptor(10 * time.Millisecond)
+
+	err := interceptor(context.Background(), "/svc/Method", nil, nil, nil, invoker)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("interceptor error = %v, want code %v", err, codes.DeadlineExceeded)
+	}
+}
+
+func TestCallPolicyUnmarshal(t *testing.T) {
+	want := &CallPolicy{
+		Timeout: 5 * time.Second,
+		Retry: &RetryPolicy{
+			MaxAttempts: 4,
+			Codes:       Codes{codes.Unavailable, codes.Aborted},
+			Backoff:     50 * time.Millisecond,
+		},
+		CircuitBreaker: &CircuitBreakerOptions{FailureThreshold: 3, FailureCodes: Codes{codes.Internal}},
+	}
+
+	tests := []struct {
+		name      string
+		unmarshal func([]byte, interface{}) error
+		data      string
+	}{
+		{
+			name:      "yaml",
+			unmarshal: yaml.Unmarshal,
+			data: `
+timeout: 5s
+retry:
+  maxAttempts: 4
+  codes: [UNAVAILABLE, aborted]
+  backoff: 50ms
+circuitBreaker:
+  failureThreshold: 3
+  failureCodes: [13]
+`,
+		},
+		{
+			name:      "json",
+			unmarshal: json.Unmarshal,
+			data: `{"timeout": 5000000000, "retry": {"maxAttempts": 4, "codes": ["UNAVAILABLE", 10],
+				"backoff": 50000000}, "circuitBreaker": {"failureThreshold": 3, "failureCodes": ["INTERNAL"]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &CallPolicy{}
+			if err := tt.unmarshal([]byte(tt.data), got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	if err := yaml.Unmarshal([]byte("codes: [NOT_A_CODE]"), &RetryPolicy{}); err == nil {
+		t.Error("expected error for unknown code")
+	}
+}
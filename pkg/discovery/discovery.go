@@ -0,0 +1,164 @@
+// Package discovery provides gRPC resolvers for locating external services
+package discovery
+
+import (
+	"context"
+	"google.golang.org/grpc/resolver"
+	"sync"
+	"time"
+)
+
+// Schemes for the resolvers provided by the package. The scheme of an external service address
+// selects the resolver e.g static:///10.0.0.1:443,10.0.0.2:443 or srv:///_grpc._tcp.account.local
+const (
+	SchemeStatic     = "static"
+	SchemeSRV        = "srv"
+	SchemeFile       = "file"
+	SchemeKubernetes = "kubernetes"
+)
+
+// DefaultRefreshInterval is how often resolvers that cannot watch for changes are polled
+const DefaultRefreshInterval = 30 * time.Second
+
+// Resolver looks up the addresses of a service
+type Resolver interface {
+	// Resolve returns the current addresses of target
+	Resolve(ctx context.Context, target string) ([]string, error)
+}
+
+// Watcher is a Resolver that is notified when addresses of a service change
+type Watcher interface {
+	Resolver
+	// Watch calls update with the current addresses of target and again whenever they change.
+	// It blocks until ctx is done or watching fails
+	Watch(ctx context.Context, target string, update func([]string)) error
+}
+
+func init() {
+	Register(SchemeStatic, StaticResolver{}, 0)
+	Register(SchemeSRV, &SRVResolver{}, DefaultRefreshInterval)
+}
+
+// Register registers r as a gRPC resolver for scheme. Resolvers that do not implement Watcher
+// are polled every refresh interval; a zero interval resolves only on start and when gRPC asks to.
+// Register must only be called during initialization and is not thread-safe
+func Register(scheme string, r Resolver, refresh time.Duration) {
+	resolver.Register(NewBuilder(scheme, r, refresh))
+}
+
+// NewBuilder creates a gRPC resolver builder for scheme backed by r
+func NewBuilder(scheme string, r Resolver, refresh time.Duration) resolver.Builder {
+	return &builder{scheme: scheme, resolver: r, refresh: refresh}
+}
+
+type builder struct {
+	scheme   string
+	resolver Resolver
+	refresh  time.Duration
+}
+
+func (b *builder) Scheme() string {
+	return b.scheme
+}
+
+func (b *builder) Build(
+	target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions,
+) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &grpcResolver{
+		target:     target.Endpoint,
+		cc:         cc,
+		resolver:   b.resolver,
+		refresh:    b.refresh,
+		ctx:        ctx,
+		cancel:     cancel,
+		resolveNow: make(chan struct{}, 1),
+	}
+
+	watcher, watch := b.resolver.(Watcher)
+
+	r.wg.Add(1)
+	go r.run(!watch)
+
+	if watch {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			err := watcher.Watch(ctx, r.target, r.update)
+			if err != nil && ctx.Err() == nil {
+				cc.ReportError(err)
+			}
+		}()
+	}
+
+	return r, nil
+}
+
+// grpcResolver adapts a Resolver to resolver.Resolver
+type grpcResolver struct {
+	target     string
+	cc         resolver.ClientConn
+	resolver   Resolver
+	refresh    time.Duration
+	ctx        context.Context
+	cancel     context.CancelFunc
+	resolveNow chan struct{}
+	wg         sync.WaitGroup
+}
+
+func (r *grpcResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (r *grpcResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *grpcResolver) run(resolveFirst bool) {
+	defer r.wg.Done()
+
+	if resolveFirst {
+		r.resolve()
+	}
+
+	var tick <-chan time.Time
+	if r.refresh > 0 {
+		ticker := time.NewTicker(r.refresh)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.resolveNow:
+		case <-tick:
+		}
+		r.resolve()
+	}
+}
+
+func (r *grpcResolver) resolve() {
+	addrs, err := r.resolver.Resolve(r.ctx, r.target)
+	if err != nil {
+		if r.ctx.Err() == nil {
+			r.cc.ReportError(err)
+		}
+		return
+	}
+	r.update(addrs)
+}
+
+func (r *grpcResolver) update(addrs []string) {
+	state := resolver.State{Addresses: make([]resolver.Address, 0, len(addrs))}
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	r.cc.UpdateState(state)
+}
@@ -0,0 +1,129 @@
+package discovery
+
+import (
+	"context"
+	"google.golang.org/grpc/resolver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClientConn records states pushed by resolvers
+type fakeClientConn struct {
+	resolver.ClientConn
+	states chan []string
+}
+
+func newFakeClientConn() *fakeClientConn {
+	return &fakeClientConn{states: make(chan []string, 10)}
+}
+
+func (cc *fakeClientConn) UpdateState(state resolver.State) {
+	addrs := make([]string, 0, len(state.Addresses))
+	for _, addr := range state.Addresses {
+		addrs = append(addrs, addr.Addr)
+	}
+	cc.states <- addrs
+}
+
+func (cc *fakeClientConn) ReportError(error) {}
+
+func (cc *fakeClientConn) wait(t *testing.T) []string {
+	t.Helper()
+	select {
+	case addrs := <-cc.states:
+		return addrs
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for resolver update")
+	}
+	return nil
+}
+
+func TestStaticResolver(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    []string
+		wantErr bool
+	}{
+		{name: "single", target: "10.0.0.1:443", want: []string{"10.0.0.1:443"}},
+		{name: "many", target: "10.0.0.1:443, 10.0.0.2:443,", want: []string{"10.0.0.1:443", "10.0.0.2:443"}},
+		{name: "empty", target: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := StaticResolver{}.Resolve(context.Background(), tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	cc := newFakeClientConn()
+	b := NewBuilder(SchemeStatic, StaticResolver{}, 0)
+
+	r, err := b.Build(resolver.Target{Scheme: SchemeStatic, Endpoint: "a:1,b:2"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	defer r.Close()
+
+	want := []string{"a:1", "b:2"}
+	if got := cc.wait(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("got addresses %v, want %v", got, want)
+	}
+
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	if got := cc.wait(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("got addresses %v after ResolveNow, want %v", got, want)
+	}
+}
+
+func TestFileRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	write := func(data string, modTime time.Time) {
+		err := ioutil.WriteFile(path, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Explicit mod times so that quick successive writes are detected
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	write(`{"Account": ["10.0.0.1:443"]}`, now)
+
+	cc := newFakeClientConn()
+	b := NewBuilder(SchemeFile, &FileRegistry{Path: path, Interval: 10 * time.Millisecond}, 0)
+
+	r, err := b.Build(resolver.Target{Scheme: SchemeFile, Endpoint: "account"}, cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	defer r.Close()
+
+	if got, want := cc.wait(t), []string{"10.0.0.1:443"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got addresses %v, want %v", got, want)
+	}
+
+	write(`{"account": ["10.0.0.1:443", "10.0.0.2:443"]}`, now.Add(time.Second))
+
+	if got, want := cc.wait(t), []string{"10.0.0.1:443", "10.0.0.2:443"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got addresses %v after file change, want %v", got, want)
+	}
+
+	_, err = (&FileRegistry{Path: path}).Resolve(context.Background(), "payment")
+	if err == nil {
+		t.Errorf("Resolve() expected error for unknown service")
+	}
+}
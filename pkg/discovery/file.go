@@ -0,0 +1,105 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// FileRegistry resolves services from a JSON file mapping service names to addresses e.g
+//
+//	{"account": ["10.0.0.1:443", "10.0.0.2:443"], "notification": ["10.0.1.1:443"]}
+//
+// The file is watched for changes so it can be updated without restarting the service
+type FileRegistry struct {
+	// Path is the path to the registry file
+	Path string
+	// Interval is how often the file is checked for changes; defaults to 5 seconds
+	Interval time.Duration
+}
+
+// RegisterFileRegistry registers a file registry at path as the resolver for the file scheme
+func RegisterFileRegistry(path string, interval time.Duration) {
+	Register(SchemeFile, &FileRegistry{Path: path, Interval: interval}, 0)
+}
+
+// Resolve returns the addresses of target in the registry file
+func (fr *FileRegistry) Resolve(_ context.Context, target string) ([]string, error) {
+	services, err := fr.read()
+	if err != nil {
+		return nil, err
+	}
+	addrs, ok := services[strings.ToLower(target)]
+	if !ok {
+		return nil, errors.Errorf("file registry: no service exists with name: %s", target)
+	}
+	return addrs, nil
+}
+
+// Watch calls update whenever the addresses of target change in the registry file
+func (fr *FileRegistry) Watch(ctx context.Context, target string, update func([]string)) error {
+	interval := fr.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		modTime time.Time
+		last    []string
+		first   = true
+	)
+
+	for {
+		// Errors are retried on the next tick since the file may be in the middle of a write;
+		// gRPC keeps using the last addresses meanwhile
+		info, err := os.Stat(fr.Path)
+		if err == nil && !info.ModTime().Equal(modTime) {
+			addrs, err := fr.Resolve(ctx, target)
+			if err == nil {
+				modTime = info.ModTime()
+				if first || !reflect.DeepEqual(addrs, last) {
+					first = false
+					last = addrs
+					update(addrs)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (fr *FileRegistry) read() (map[string][]string, error) {
+	data, err := ioutil.ReadFile(fr.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "file registry: failed to read registry file")
+	}
+
+	services := make(map[string][]string)
+	err = json.Unmarshal(data, &services)
+	if err != nil {
+		return nil, errors.Wrap(err, "file registry: failed to decode registry file")
+	}
+
+	// Service names are case insensitive like external services in config
+	for name, addrs := range services {
+		if lower := strings.ToLower(name); lower != name {
+			delete(services, name)
+			services[lower] = addrs
+		}
+	}
+
+	return services, nil
+}
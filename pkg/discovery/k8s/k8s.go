@@ -0,0 +1,195 @@
+// Package k8s resolves external services using the kubernetes endpoints API
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"github.com/gidyon/micros/pkg/discovery"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolver resolves targets in the form name[.namespace][:port] to the ready addresses of the
+// endpoints object of a kubernetes service. Port may be a port name or number and can be
+// omitted when the endpoints expose a single port
+type Resolver struct {
+	Client kubernetes.Interface
+	// Namespace is used for targets without a namespace; defaults to "default"
+	Namespace string
+	// Logger logs watch failures; they are retried with backoff
+	Logger logging.Logger
+}
+
+// backoff between failed watches, doubled after every failure up to maxBackoff
+var (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// Register registers a kubernetes resolver for the kubernetes scheme e.g kubernetes:///account.default:grpc
+func Register(client kubernetes.Interface, namespace string) {
+	discovery.Register(discovery.SchemeKubernetes, &Resolver{Client: client, Namespace: namespace}, 0)
+}
+
+type target struct {
+	name      string
+	namespace string
+	port      string
+}
+
+func (r *Resolver) parseTarget(s string) (*target, error) {
+	t := &target{namespace: r.Namespace}
+	if t.namespace == "" {
+		t.namespace = metav1.NamespaceDefault
+	}
+
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		t.port = s[i+1:]
+		s = s[:i]
+	}
+
+	parts := strings.SplitN(s, ".", 2)
+	t.name = parts[0]
+	if len(parts) == 2 && parts[1] != "" {
+		t.namespace = parts[1]
+	}
+
+	if t.name == "" {
+		return nil, errors.Errorf("k8s resolver: missing service name in target %q", s)
+	}
+
+	return t, nil
+}
+
+// Resolve returns the ready addresses of target
+func (r *Resolver) Resolve(ctx context.Context, s string) ([]string, error) {
+	t, err := r.parseTarget(s)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints, err := r.Client.CoreV1().Endpoints(t.namespace).Get(ctx, t.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "k8s resolver: failed to get endpoints for %s", s)
+	}
+
+	return addresses(endpoints, t.port)
+}
+
+// Watch calls update with the ready addresses of target whenever its endpoints change. Failures to watch
+// or to read the endpoints are logged and retried with backoff until ctx is done
+func (r *Resolver) Watch(ctx context.Context, s string, update func([]string)) error {
+	t, err := r.parseTarget(s)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.OrNop(r.Logger)
+	backoff := minBackoff
+
+	for {
+		delay := time.Second
+		if err := r.watchOnce(ctx, s, t, update); err != nil {
+			logger.Warn("k8s resolver: watch failed, retrying", "target", s, "backoff", backoff.String(), "error", err)
+			delay = backoff
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		} else {
+			// watch expired; list again and restart it
+			backoff = minBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watchOnce lists the endpoints of t and watches them until the watch expires or fails
+func (r *Resolver) watchOnce(ctx context.Context, s string, t *target, update func([]string)) error {
+	addrs, err := r.Resolve(ctx, s)
+	if err != nil {
+		return err
+	}
+	update(addrs)
+
+	w, err := r.Client.CoreV1().Endpoints(t.namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: "metadata.name=" + t.name,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "k8s resolver: failed to watch endpoints for %s", s)
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			if event.Type == watch.Error {
+				return errors.Errorf("k8s resolver: watch of endpoints for %s failed", s)
+			}
+			endpoints, ok := event.Object.(*corev1.Endpoints)
+			if !ok || endpoints.Name != t.name {
+				continue
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				addrs, err := addresses(endpoints, t.port)
+				if err != nil {
+					return err
+				}
+				update(addrs)
+			case watch.Deleted:
+				update([]string{})
+			}
+		}
+	}
+}
+
+func addresses(endpoints *corev1.Endpoints, port string) ([]string, error) {
+	addrs := make([]string, 0)
+	for _, subset := range endpoints.Subsets {
+		portNumber, err := findPort(subset.Ports, port)
+		if err != nil {
+			return nil, errors.Wrapf(err, "k8s resolver: endpoints %s", endpoints.Name)
+		}
+		for _, address := range subset.Addresses {
+			addrs = append(addrs, net.JoinHostPort(address.IP, fmt.Sprint(portNumber)))
+		}
+	}
+	return addrs, nil
+}
+
+func findPort(ports []corev1.EndpointPort, port string) (int32, error) {
+	if port == "" {
+		if len(ports) != 1 {
+			return 0, errors.New("port must be specified when endpoints have multiple ports")
+		}
+		return ports[0].Port, nil
+	}
+
+	number, err := strconv.Atoi(port)
+	for _, p := range ports {
+		if p.Name == port || (err == nil && int(p.Port) == number) {
+			return p.Port, nil
+		}
+	}
+
+	return 0, errors.Errorf("no port named %s", port)
+}
@@ -0,0 +1,156 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newEndpoints(name, namespace string, ips ...string) *corev1.Endpoints {
+	addresses := make([]corev1.EndpointAddress, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, corev1.EndpointAddress{IP: ip})
+	}
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: addresses,
+			Ports: []corev1.EndpointPort{
+				{Name: "grpc", Port: 8080},
+				{Name: "metrics", Port: 9090},
+			},
+		}},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		newEndpoints("account", "default", "10.0.0.1", "10.0.0.2"),
+		newEndpoints("payment", "billing", "10.0.1.1"),
+	)
+	r := &Resolver{Client: client}
+
+	tests := []struct {
+		name    string
+		target  string
+		want    []string
+		wantErr bool
+	}{
+		{name: "port name", target: "account:grpc", want: []string{"10.0.0.1:8080", "10.0.0.2:8080"}},
+		{name: "port number", target: "account.default:9090", want: []string{"10.0.0.1:9090", "10.0.0.2:9090"}},
+		{name: "namespace", target: "payment.billing:grpc", want: []string{"10.0.1.1:8080"}},
+		{name: "ambiguous port", target: "account", wantErr: true},
+		{name: "unknown port", target: "account:http", wantErr: true},
+		{name: "unknown service", target: "payment:grpc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(context.Background(), tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	client := fake.NewSimpleClientset(newEndpoints("account", "default", "10.0.0.1"))
+	r := &Resolver{Client: client}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates := make(chan []string, 10)
+	go r.Watch(ctx, "account:grpc", func(addrs []string) { updates <- addrs })
+
+	wait := func() []string {
+		select {
+		case addrs := <-updates:
+			return addrs
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for update")
+		}
+		return nil
+	}
+
+	if got, want := wait(), []string{"10.0.0.1:8080"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got addresses %v, want %v", got, want)
+	}
+
+	// Give the watch time to be established before updating
+	time.Sleep(100 * time.Millisecond)
+
+	_, err := client.CoreV1().Endpoints("default").Update(
+		ctx, newEndpoints("account", "default", "10.0.0.1", "10.0.0.3"), metav1.UpdateOptions{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := wait(), []string{"10.0.0.1:8080", "10.0.0.3:8080"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got addresses %v after update, want %v", got, want)
+	}
+}
+
+func TestWatchRetries(t *testing.T) {
+	defer func(min time.Duration) { minBackoff = min }(minBackoff)
+	minBackoff = 10 * time.Millisecond
+
+	client := fake.NewSimpleClientset(newEndpoints("account", "default", "10.0.0.1"))
+	failures := 2
+	client.PrependWatchReactor("endpoints", func(k8stesting.Action) (bool, watch.Interface, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, errors.New("api server unavailable")
+		}
+		return false, nil, nil
+	})
+	r := &Resolver{Client: client}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates := make(chan []string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Watch(ctx, "account:grpc", func(addrs []string) { updates <- addrs })
+	}()
+
+	// the endpoints are listed again after every failed watch
+	for i := 0; i < 3; i++ {
+		select {
+		case <-updates:
+		case err := <-done:
+			t.Fatalf("Watch returned after a failure: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for update")
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	_, err := client.CoreV1().Endpoints("default").Update(
+		ctx, newEndpoints("account", "default", "10.0.0.2"), metav1.UpdateOptions{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case addrs := <-updates:
+		if want := []string{"10.0.0.2:8080"}; !reflect.DeepEqual(addrs, want) {
+			t.Errorf("got addresses %v after recovery, want %v", addrs, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for update after recovery")
+	}
+}
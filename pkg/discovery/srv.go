@@ -0,0 +1,37 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+)
+
+// SRVResolver resolves a DNS SRV record name e.g _grpc._tcp.account.default.svc.cluster.local
+// to the targets and ports in the record
+type SRVResolver struct {
+	// Resolver is used for lookups; net.DefaultResolver is used when nil
+	Resolver *net.Resolver
+}
+
+// Resolve looks up the SRV records of target
+func (sr *SRVResolver) Resolve(ctx context.Context, target string) ([]string, error) {
+	r := sr.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	_, records, err := r.LookupSRV(ctx, "", "", target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "srv resolver: failed to lookup %s", target)
+	}
+
+	addrs := make([]string, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(host, fmt.Sprint(record.Port)))
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,25 @@
+package discovery
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// StaticResolver resolves a comma separated list of addresses to itself
+type StaticResolver struct{}
+
+// Resolve splits target into addresses
+func (StaticResolver) Resolve(_ context.Context, target string) ([]string, error) {
+	addrs := make([]string, 0)
+	for _, addr := range strings.Split(target, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("static resolver: no addresses in target")
+	}
+	return addrs, nil
+}
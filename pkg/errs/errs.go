@@ -0,0 +1,179 @@
+// Package errs contains typed domain errors and their translation to gRPC statuses.
+//
+// Handlers return errors such as errs.NotFound("account %s not found", id) and the interceptors translate
+// them to a status.Status with the matching code and details. Errors from database/sql, gorm, MySQL,
+// Postgres drivers and redis are translated too, so that clients don't see codes.Unknown for them.
+package errs
+
+import (
+	"fmt"
+	"google.golang.org/grpc/codes"
+)
+
+// Kind is the category of an error. Each kind maps to a gRPC code
+type Kind uint8
+
+// Error kinds
+const (
+	KindUnknown Kind = iota
+	KindNotFound
+	KindAlreadyExists
+	KindConflict
+	KindValidation
+	KindUnauthenticated
+	KindPermissionDenied
+	KindFailedPrecondition
+	KindResourceExhausted
+	KindUnavailable
+	KindInternal
+)
+
+var kindCodes = map[Kind]codes.Code{
+	KindUnknown:            codes.Unknown,
+	KindNotFound:           codes.NotFound,
+	KindAlreadyExists:      codes.AlreadyExists,
+	KindConflict:           codes.Aborted,
+	KindValidation:         codes.InvalidArgument,
+	KindUnauthenticated:    codes.Unauthenticated,
+	KindPermissionDenied:   codes.PermissionDenied,
+	KindFailedPrecondition: codes.FailedPrecondition,
+	KindResourceExhausted:  codes.ResourceExhausted,
+	KindUnavailable:        codes.Unavailable,
+	KindInternal:           codes.Internal,
+}
+
+var kindNames = map[Kind]string{
+	KindUnknown:            "unknown",
+	KindNotFound:           "not found",
+	KindAlreadyExists:      "already exists",
+	KindConflict:           "conflict",
+	KindValidation:         "validation failed",
+	KindUnauthenticated:    "unauthenticated",
+	KindPermissionDenied:   "permission denied",
+	KindFailedPrecondition: "failed precondition",
+	KindResourceExhausted:  "resource exhausted",
+	KindUnavailable:        "unavailable",
+	KindInternal:           "internal error",
+}
+
+// String returns a short description of the kind
+func (kind Kind) String() string {
+	if name, ok := kindNames[kind]; ok {
+		return name
+	}
+	return kindNames[KindUnknown]
+}
+
+// GRPCCode returns the gRPC code of the kind
+func (kind Kind) GRPCCode() codes.Code {
+	if code, ok := kindCodes[kind]; ok {
+		return code
+	}
+	return codes.Unknown
+}
+
+// FieldViolation describes an invalid request field
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// Error is a domain error. Message is returned to clients while the wrapped Err is only logged
+type Error struct {
+	Kind    Kind
+	Message string
+	// Reason is a machine readable cause such as ACCOUNT_LOCKED, sent with Metadata as errdetails.ErrorInfo
+	Reason     string
+	Metadata   map[string]string
+	Violations []FieldViolation
+	Err        error
+}
+
+// Error returns the message and the wrapped error
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Kind.String()
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the wrapped error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Cause returns the wrapped error for errors.Cause
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// WithReason sets the machine readable reason and metadata of the error
+func (e *Error) WithReason(reason string, metadata map[string]string) *Error {
+	e.Reason = reason
+	e.Metadata = metadata
+	return e
+}
+
+// New creates an error of the given kind
+func New(kind Kind, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap creates an error of the given kind wrapping err. err is not returned to clients
+func Wrap(err error, kind Kind, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// NotFound creates a KindNotFound error
+func NotFound(format string, args ...interface{}) *Error {
+	return New(KindNotFound, format, args...)
+}
+
+// AlreadyExists creates a KindAlreadyExists error
+func AlreadyExists(format string, args ...interface{}) *Error {
+	return New(KindAlreadyExists, format, args...)
+}
+
+// Conflict creates a KindConflict error, e.g. for a failed optimistic lock
+func Conflict(format string, args ...interface{}) *Error {
+	return New(KindConflict, format, args...)
+}
+
+// Validation creates a KindValidation error with the given field violations
+func Validation(message string, violations ...FieldViolation) *Error {
+	return &Error{Kind: KindValidation, Message: message, Violations: violations}
+}
+
+// Unauthenticated creates a KindUnauthenticated error
+func Unauthenticated(format string, args ...interface{}) *Error {
+	return New(KindUnauthenticated, format, args...)
+}
+
+// PermissionDenied creates a KindPermissionDenied error
+func PermissionDenied(format string, args ...interface{}) *Error {
+	return New(KindPermissionDenied, format, args...)
+}
+
+// FailedPrecondition creates a KindFailedPrecondition error
+func FailedPrecondition(format string, args ...interface{}) *Error {
+	return New(KindFailedPrecondition, format, args...)
+}
+
+// ResourceExhausted creates a KindResourceExhausted error
+func ResourceExhausted(format string, args ...interface{}) *Error {
+	return New(KindResourceExhausted, format, args...)
+}
+
+// Unavailable creates a KindUnavailable error
+func Unavailable(format string, args ...interface{}) *Error {
+	return New(KindUnavailable, format, args...)
+}
+
+// Internal creates a KindInternal error wrapping err
+func Internal(err error, format string, args ...interface{}) *Error {
+	return Wrap(err, KindInternal, format, args...)
+}
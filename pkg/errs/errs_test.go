@@ -0,0 +1,96 @@
+package errs
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-redis/redis"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+type pgError struct{ code string }
+
+func (e *pgError) Error() string    { return "pg error " + e.code }
+func (e *pgError) SQLState() string { return e.code }
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		message string
+	}{
+		{name: "not found", err: NotFound("account %d not found", 7), code: codes.NotFound, message: "account 7 not found"},
+		{name: "wrapped domain error", err: errors.Wrap(Conflict("version mismatch"), "update failed"), code: codes.Aborted, message: "version mismatch"},
+		{name: "cause is not sent", err: Internal(errors.New("dial tcp 10.0.0.1"), "failed to save account"), code: codes.Internal, message: "failed to save account"},
+		{name: "default message", err: &Error{Kind: KindUnauthenticated}, code: codes.Unauthenticated, message: "unauthenticated"},
+		{name: "sql no rows", err: errors.Wrap(sql.ErrNoRows, "select"), code: codes.NotFound, message: "not found"},
+		{name: "gorm record not found", err: gorm.Errors{gorm.ErrRecordNotFound}, code: codes.NotFound, message: "not found"},
+		{name: "redis nil", err: errors.WithMessage(redis.Nil, "get session"), code: codes.NotFound, message: "not found"},
+		{name: "mysql duplicate entry", err: &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, code: codes.AlreadyExists, message: "already exists"},
+		{name: "mysql other error", err: &mysql.MySQLError{Number: 1213, Message: "Deadlock"}, code: codes.Unknown, message: "Error 1213: Deadlock"},
+		{name: "postgres unique violation", err: errors.Wrap(&pgError{code: "23505"}, "insert"), code: codes.AlreadyExists, message: "already exists"},
+		{name: "deadline", err: errors.Wrap(context.DeadlineExceeded, "query"), code: codes.DeadlineExceeded, message: "context deadline exceeded"},
+		{name: "status", err: errors.Wrap(status.Error(codes.OutOfRange, "page too large"), "list"), code: codes.OutOfRange, message: "page too large"},
+		{name: "plain", err: errors.New("boom"), code: codes.Unknown, message: "boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := Status(tt.err)
+			if st.Code() != tt.code || st.Message() != tt.message {
+				t.Errorf("got %s %q, want %s %q", st.Code(), st.Message(), tt.code, tt.message)
+			}
+		})
+	}
+
+	if Status(nil) != nil || Translate(nil) != nil {
+		t.Errorf("nil errors must stay nil")
+	}
+}
+
+func TestStatusDetails(t *testing.T) {
+	err := Validation("invalid account", FieldViolation{Field: "email", Description: "is required"}).
+		WithReason("ACCOUNT_INVALID", map[string]string{"account": "7"})
+
+	details := Status(err).Details()
+	if len(details) != 2 {
+		t.Fatalf("got %d details, want 2", len(details))
+	}
+	badRequest, ok := details[0].(*errdetails.BadRequest)
+	if !ok || badRequest.FieldViolations[0].Field != "email" || badRequest.FieldViolations[0].Description != "is required" {
+		t.Errorf("unexpected bad request %v", details[0])
+	}
+	info, ok := details[1].(*errdetails.ErrorInfo)
+	if !ok || info.Reason != "ACCOUNT_INVALID" || info.Metadata["account"] != "7" {
+		t.Errorf("unexpected error info %v", details[1])
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	err := errors.Wrap(Wrap(sql.ErrNoRows, KindNotFound, "account not found"), "get account")
+	if !Is(err, KindNotFound) || Is(err, KindInternal) || Is(nil, KindUnknown) {
+		t.Errorf("unexpected kind %s", KindOf(err))
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("the wrapped error must be reachable")
+	}
+	if got := err.Error(); got != "get account: account not found: sql: no rows in result set" {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	_, err := UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, errors.Wrap(sql.ErrNoRows, "select account")
+		})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("code = %s, want NotFound", status.Code(err))
+	}
+}
@@ -0,0 +1,25 @@
+package errs
+
+import (
+	"context"
+	"google.golang.org/grpc"
+)
+
+// UnaryServerInterceptor translates errors returned by handlers to gRPC statuses
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, Translate(err)
+	}
+}
+
+// StreamServerInterceptor translates errors returned by stream handlers to gRPC statuses
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		return Translate(handler(srv, ss))
+	}
+}
@@ -0,0 +1,129 @@
+package errs
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-redis/redis"
+	"github.com/go-sql-driver/mysql"
+	"github.com/golang/protobuf/proto"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	mysqlDuplicateEntry   = 1062
+	postgresUniqueViolate = "23505"
+)
+
+// KindOf returns the kind of err. sql.ErrNoRows, gorm.ErrRecordNotFound and redis.Nil are KindNotFound
+// and duplicate key errors from MySQL and Postgres are KindAlreadyExists
+func KindOf(err error) Kind {
+	var e *Error
+	switch {
+	case err == nil:
+		return KindUnknown
+	case errors.As(err, &e):
+		return e.Kind
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, gorm.ErrRecordNotFound), gorm.IsRecordNotFoundError(err),
+		errors.Is(err, redis.Nil):
+		return KindNotFound
+	case isDuplicateKey(err):
+		return KindAlreadyExists
+	}
+	return KindUnknown
+}
+
+// Is reports whether err is of the given kind
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
+
+// isDuplicateKey reports whether err is a unique constraint violation
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDuplicateEntry
+	}
+	// pgconn.PgError and other drivers exposing the SQLSTATE
+	var sqlStateErr interface{ SQLState() string }
+	if errors.As(err, &sqlStateErr) {
+		return sqlStateErr.SQLState() == postgresUniqueViolate
+	}
+	return false
+}
+
+// Status converts err to a gRPC status. gRPC status errors are returned as is, errors of a known kind get
+// the kind's code and details and other errors are codes.Unknown. Status returns nil for a nil error
+func Status(err error) *status.Status {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e.GRPCStatus()
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		return grpcErr.GRPCStatus()
+	}
+
+	if kind := KindOf(err); kind != KindUnknown {
+		return status.New(kind.GRPCCode(), kind.String())
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, context.Canceled.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, context.DeadlineExceeded.Error())
+	}
+
+	return status.New(codes.Unknown, err.Error())
+}
+
+// Translate converts err to a gRPC status error as Status does
+func Translate(err error) error {
+	if err == nil {
+		return nil
+	}
+	return Status(err).Err()
+}
+
+// GRPCStatus returns the status sent to clients. Violations are sent as errdetails.BadRequest and
+// the reason as errdetails.ErrorInfo
+func (e *Error) GRPCStatus() *status.Status {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Kind.String()
+	}
+	st := status.New(e.Kind.GRPCCode(), msg)
+
+	details := make([]proto.Message, 0, 2)
+	if len(e.Violations) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, violation := range e.Violations {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       violation.Field,
+				Description: violation.Description,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	if e.Reason != "" {
+		details = append(details, &errdetails.ErrorInfo{Reason: e.Reason, Metadata: e.Metadata})
+	}
+	if len(details) == 0 {
+		return st
+	}
+
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// DedupeStore remembers the events processed by a subscriber group
+type DedupeStore interface {
+	// Processed reports whether the event was processed by group
+	Processed(ctx context.Context, group, eventID string) (bool, error)
+	// MarkProcessed remembers that the event was processed by group for ttl
+	MarkProcessed(ctx context.Context, group, eventID string, ttl time.Duration) error
+}
+
+// Dedupe wraps handler so that events already processed by group are skipped. Events are marked processed
+// after handler succeeds, so a crash between the two still delivers the event again; handlers that must run
+// exactly once should record the event id in the same transaction as their changes
+func Dedupe(store DedupeStore, group string, ttl time.Duration, handler Handler) Handler {
+	return func(ctx context.Context, event *Event) error {
+		processed, err := store.Processed(ctx, group, event.ID)
+		if err != nil {
+			return err
+		}
+		if processed {
+			return nil
+		}
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+		return store.MarkProcessed(ctx, group, event.ID, ttl)
+	}
+}
+
+// MemoryDedupeStore keeps processed event ids in memory
+type MemoryDedupeStore struct {
+	mu        sync.Mutex
+	processed map[string]time.Time
+}
+
+// NewMemoryDedupeStore creates an in-memory dedupe store
+func NewMemoryDedupeStore() *MemoryDedupeStore {
+	return &MemoryDedupeStore{processed: make(map[string]time.Time)}
+}
+
+// Processed reports whether the event was processed by group and has not expired
+func (store *MemoryDedupeStore) Processed(ctx context.Context, group, eventID string) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	expires, ok := store.processed[group+"/"+eventID]
+	if ok && time.Now().After(expires) {
+		delete(store.processed, group+"/"+eventID)
+		return false, nil
+	}
+	return ok, nil
+}
+
+// MarkProcessed remembers that the event was processed by group for ttl
+func (store *MemoryDedupeStore) MarkProcessed(ctx context.Context, group, eventID string, ttl time.Duration) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.processed[group+"/"+eventID] = time.Now().Add(ttl)
+	return nil
+}
+
+// RedisDedupeStore keeps processed event ids in redis keys that expire after the ttl
+type RedisDedupeStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisDedupeStore creates a dedupe store using client. Keys are prefixed with events:processed: when prefix
+// is empty
+func NewRedisDedupeStore(client *redis.Client, prefix string) *RedisDedupeStore {
+	if prefix == "" {
+		prefix = "events:processed:"
+	}
+	return &RedisDedupeStore{client: client, prefix: prefix}
+}
+
+// Processed reports whether the event was processed by group
+func (store *RedisDedupeStore) Processed(ctx context.Context, group, eventID string) (bool, error) {
+	n, err := store.client.WithContext(ctx).Exists(store.prefix + group + ":" + eventID).Result()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to check processed event")
+	}
+	return n > 0, nil
+}
+
+// MarkProcessed remembers that the event was processed by group for ttl
+func (store *RedisDedupeStore) MarkProcessed(ctx context.Context, group, eventID string, ttl time.Duration) error {
+	err := store.client.WithContext(ctx).Set(store.prefix+group+":"+eventID, 1, ttl).Err()
+	return errors.Wrap(err, "failed to mark event processed")
+}
@@ -0,0 +1,79 @@
+// Package events publishes domain events reliably using a transactional outbox.
+//
+// Events are written to the outbox table in the same transaction as the domain changes that produced them.
+// A Relay publishes outbox events to a Broker and marks them published, so events are never lost but may be
+// published more than once. Subscribers get at-least-once delivery and can use Dedupe to skip duplicates.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Event is a domain event
+type Event struct {
+	// ID uniquely identifies the event and is used to detect duplicates
+	ID string `json:"id"`
+	// Topic is the stream or channel the event is published to e.g accounts.created
+	Topic string `json:"topic"`
+	// Key identifies the entity the event is about e.g the account id
+	Key       string            `json:"key,omitempty"`
+	Payload   []byte            `json:"payload"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// New creates an event with a new id
+func New(topic, key string, payload []byte) *Event {
+	return &Event{
+		ID:        uuid.New().String(),
+		Topic:     topic,
+		Key:       key,
+		Payload:   payload,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// NewJSON creates an event whose payload is v encoded as JSON
+func NewJSON(topic, key string, v interface{}) (*Event, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal %s event payload", topic)
+	}
+	return New(topic, key, payload), nil
+}
+
+// Handler processes an event. Events whose handler fails are delivered again
+type Handler func(ctx context.Context, event *Event) error
+
+// Publisher publishes events to a broker
+type Publisher interface {
+	Publish(ctx context.Context, events ...*Event) error
+}
+
+// Subscriber delivers the events of a topic to handler. Subscribers sharing a group share the events of the
+// topic while each group gets every event. Subscribe blocks until ctx is done or delivery fails
+type Subscriber interface {
+	Subscribe(ctx context.Context, topic, group string, handler Handler) error
+}
+
+// Broker publishes and delivers events
+type Broker interface {
+	Publisher
+	Subscriber
+}
+
+// sleep waits for d or until ctx is done. It reports whether ctx is still active
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,238 @@
+package events
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gidyon/micros/internal/testutil"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector records the keys of handled events and fails the first delivery of the keys in failOnce
+type collector struct {
+	mu       sync.Mutex
+	keys     []string
+	failOnce map[string]bool
+	done     chan struct{}
+	want     int
+}
+
+func newCollector(want int, failOnce ...string) *collector {
+	c := &collector{failOnce: make(map[string]bool), done: make(chan struct{}), want: want}
+	for _, key := range failOnce {
+		c.failOnce[key] = true
+	}
+	return c
+}
+
+func (c *collector) handle(ctx context.Context, event *Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failOnce[event.Key] {
+		c.failOnce[event.Key] = false
+		return errors.New("temporary failure")
+	}
+	c.keys = append(c.keys, event.Key)
+	if len(c.keys) == c.want {
+		close(c.done)
+	}
+	return nil
+}
+
+func (c *collector) wait(t *testing.T) []string {
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for events, got %v", c.keys)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.keys...)
+}
+
+func publishAccounts(t *testing.T, publisher Publisher, keys ...string) {
+	for _, key := range keys {
+		event, err := NewJSON("accounts", key, map[string]string{"id": key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.Headers = map[string]string{"source": "test"}
+		if err := publisher.Publish(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryBroker(t *testing.T) {
+	broker := NewMemoryBroker()
+	broker.RetryInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	billing, audit := newCollector(3, "b"), newCollector(3)
+	go broker.Subscribe(ctx, "accounts", "billing", billing.handle)
+	go broker.Subscribe(ctx, "accounts", "audit", audit.handle)
+
+	publishAccounts(t, broker, "a", "b", "c")
+
+	// the failed event is delivered again
+	if got := billing.wait(t); !reflect.DeepEqual(got, []string{"a", "b", "c"}) || billing.failOnce["b"] {
+		t.Errorf("billing got %v", got)
+	}
+	if got := audit.wait(t); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("audit got %v", got)
+	}
+}
+
+func TestRedisBroker(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	broker, err := NewRedisBroker(client, nil, &RedisOptions{Consumer: "worker-1", RetryDelay: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publishAccounts(t, broker, "a", "b", "c")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newCollector(3, "b")
+	go broker.Subscribe(ctx, "accounts", "billing", func(ctx context.Context, event *Event) error {
+		if event.Topic != "accounts" || event.Headers["source"] != "test" || string(event.Payload) == "" {
+			t.Errorf("unexpected event %+v", event)
+		}
+		return c.handle(ctx, event)
+	})
+
+	if got := c.wait(t); !reflect.DeepEqual(got, []string{"a", "c", "b"}) {
+		t.Errorf("got %v", got)
+	}
+	cancel()
+
+	// every event is acknowledged
+	testutil.WaitFor(t, "every event to be acknowledged", func() bool {
+		pending, err := client.XPending(broker.Stream("accounts"), "billing").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pending.Count == 0
+	})
+}
+
+func TestRedisBrokerReclaimsEventsOfDeadConsumers(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	newBroker := func(consumer string) *RedisBroker {
+		broker, err := NewRedisBroker(client, nil, &RedisOptions{Consumer: consumer, RetryDelay: 20 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return broker
+	}
+
+	publishAccounts(t, newBroker("worker-1"), "a")
+
+	// the first consumer dies while handling the event, leaving it pending on worker-1
+	ctx, cancel := context.WithCancel(context.Background())
+	handling := make(chan struct{})
+	go newBroker("worker-1").Subscribe(ctx, "accounts", "billing", func(ctx context.Context, event *Event) error {
+		close(handling)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-handling
+	cancel()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	c := newCollector(1)
+	go newBroker("worker-2").Subscribe(ctx, "accounts", "billing", c.handle)
+
+	if got := c.wait(t); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestRedisBrokerDeadLettersFailingEvents(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	broker, err := NewRedisBroker(client, nil, &RedisOptions{MaxRetries: 2, RetryDelay: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publishAccounts(t, broker, "a", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newCollector(4)
+	go broker.Subscribe(ctx, "accounts", "billing", func(ctx context.Context, event *Event) error {
+		if event.Key == "a" {
+			c.handle(ctx, event)
+			return errors.New("always fails")
+		}
+		return c.handle(ctx, event)
+	})
+
+	// a is delivered once and retried twice; b is handled once
+	if got := c.wait(t); !reflect.DeepEqual(got, []string{"a", "b", "a", "a"}) {
+		t.Errorf("got %v", got)
+	}
+
+	var dead []redis.XMessage
+	testutil.WaitFor(t, "a to be dead-lettered", func() bool {
+		dead, err = client.XRange(broker.DeadLetterStream("accounts"), "-", "+").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(dead) > 0
+	})
+	if len(dead) != 1 || dead[0].Values["key"] != "a" || dead[0].Values["dlq_error"] != "always fails" {
+		t.Errorf("unexpected dead-lettered events %v", dead)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	store := NewMemoryDedupeStore()
+	calls := 0
+	handler := Dedupe(store, "billing", time.Minute, func(ctx context.Context, event *Event) error {
+		calls++
+		if calls == 1 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	event := New("accounts", "a", nil)
+	for i := 0; i < 3; i++ {
+		handler(context.Background(), event)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+
+	// another group processes the event too
+	if processed, _ := store.Processed(context.Background(), "audit", event.ID); processed {
+		t.Errorf("event must not be processed by another group")
+	}
+}
@@ -0,0 +1,123 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBroker is an in-process broker for tests and local development. Events are kept in memory
+// and failed events are delivered again after RetryInterval
+type MemoryBroker struct {
+	// RetryInterval is how long a subscriber waits before delivering a failed event again. Defaults to 100ms
+	RetryInterval time.Duration
+
+	mu     sync.Mutex
+	topics map[string][]*Event
+	groups map[string]*memoryGroup
+	notify chan struct{}
+}
+
+// memoryGroup is the delivery state of a subscriber group
+type memoryGroup struct {
+	offset int
+	retry  []*Event
+}
+
+// NewMemoryBroker creates an in-memory broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		RetryInterval: 100 * time.Millisecond,
+		topics:        make(map[string][]*Event),
+		groups:        make(map[string]*memoryGroup),
+		notify:        make(chan struct{}),
+	}
+}
+
+// Publish appends events to their topics
+func (broker *MemoryBroker) Publish(ctx context.Context, events ...*Event) error {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for _, event := range events {
+		broker.topics[event.Topic] = append(broker.topics[event.Topic], event)
+	}
+
+	// wake up waiting subscribers
+	close(broker.notify)
+	broker.notify = make(chan struct{})
+
+	return nil
+}
+
+// Events returns the events published to topic
+func (broker *MemoryBroker) Events(topic string) []*Event {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	return append([]*Event(nil), broker.topics[topic]...)
+}
+
+// next returns the next event of topic for group, or a channel closed when events are published
+func (broker *MemoryBroker) next(topic, group string) (*Event, <-chan struct{}) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	state, ok := broker.groups[topic+"/"+group]
+	if !ok {
+		state = &memoryGroup{}
+		broker.groups[topic+"/"+group] = state
+	}
+
+	if len(state.retry) > 0 {
+		event := state.retry[0]
+		state.retry = state.retry[1:]
+		return event, nil
+	}
+	if events := broker.topics[topic]; state.offset < len(events) {
+		state.offset++
+		return events[state.offset-1], nil
+	}
+	return nil, broker.notify
+}
+
+// requeue delivers event to group again
+func (broker *MemoryBroker) requeue(topic, group string, event *Event) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	state := broker.groups[topic+"/"+group]
+	state.retry = append(state.retry, event)
+
+	close(broker.notify)
+	broker.notify = make(chan struct{})
+}
+
+// Subscribe delivers the events of topic to handler until ctx is done, starting from the first event
+// published to the topic when group is new
+func (broker *MemoryBroker) Subscribe(ctx context.Context, topic, group string, handler Handler) error {
+	retryInterval := broker.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = 100 * time.Millisecond
+	}
+
+	for {
+		event, published := broker.next(topic, group)
+		if event == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-published:
+			}
+			continue
+		}
+
+		if err := handler(ctx, event); err != nil {
+			active := sleep(ctx, retryInterval)
+			broker.requeue(topic, group, event)
+			if !active {
+				return ctx.Err()
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"regexp"
+	"time"
+)
+
+// DefaultOutboxTable is the table used by Outbox when no table is given
+const DefaultOutboxTable = "event_outbox"
+
+var validTable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// Execer executes statements. It is implemented by *sql.DB and *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Outbox stores events in a MySQL table until they are published by a Relay
+type Outbox struct {
+	db    *sql.DB
+	table string
+}
+
+// NewOutbox creates an outbox using the given table of db. DefaultOutboxTable is used when table is empty
+func NewOutbox(db *sql.DB, table string) (*Outbox, error) {
+	if db == nil {
+		return nil, errors.New("outbox db must not be nil")
+	}
+	if table == "" {
+		table = DefaultOutboxTable
+	}
+	if !validTable.MatchString(table) {
+		return nil, errors.Errorf("invalid outbox table name %q", table)
+	}
+	return &Outbox{db: db, table: table}, nil
+}
+
+// CreateTable creates the outbox table if it does not exist
+func (outbox *Outbox) CreateTable(ctx context.Context) error {
+	_, err := outbox.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	seq BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	id CHAR(36) NOT NULL UNIQUE,
+	topic VARCHAR(255) NOT NULL,
+	event_key VARCHAR(255) NOT NULL,
+	payload MEDIUMBLOB,
+	headers TEXT,
+	created_at BIGINT NOT NULL,
+	published_at BIGINT NULL,
+	INDEX (published_at, seq)
+)`, outbox.table))
+	return errors.Wrapf(err, "failed to create table %s", outbox.table)
+}
+
+func (outbox *Outbox) insertQuery() string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (id, topic, event_key, payload, headers, created_at) VALUES (?, ?, ?, ?, ?, ?)", outbox.table,
+	)
+}
+
+// insertArgs returns the values inserted for event
+func insertArgs(event *Event) ([]interface{}, error) {
+	if event.ID == "" || event.Topic == "" {
+		return nil, errors.New("outbox events must have an id and a topic")
+	}
+	headers, err := json.Marshal(event.Headers)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal event headers")
+	}
+	createdAt := event.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	return []interface{}{event.ID, event.Topic, event.Key, event.Payload, string(headers), unixMillis(createdAt)}, nil
+}
+
+// Add writes events to the outbox using tx, which should be the transaction making the domain changes
+func (outbox *Outbox) Add(ctx context.Context, tx Execer, events ...*Event) error {
+	query := outbox.insertQuery()
+	for _, event := range events {
+		args, err := insertArgs(event)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return errors.Wrapf(err, "failed to add %s event to outbox", event.Topic)
+		}
+	}
+	return nil
+}
+
+// AddGorm writes events to the outbox using the gorm transaction tx
+func (outbox *Outbox) AddGorm(tx *gorm.DB, events ...*Event) error {
+	query := outbox.insertQuery()
+	for _, event := range events {
+		args, err := insertArgs(event)
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec(query, args...).Error; err != nil {
+			return errors.Wrapf(err, "failed to add %s event to outbox", event.Topic)
+		}
+	}
+	return nil
+}
+
+// DeletePublished deletes events published before t
+func (outbox *Outbox) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	res, err := outbox.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE published_at IS NOT NULL AND published_at < ?", outbox.table,
+	), unixMillis(before))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to delete published events")
+	}
+	return res.RowsAffected()
+}
+
+// pending returns up to limit unpublished events in the order they were added. The rows are locked by tx
+func (outbox *Outbox) pending(ctx context.Context, tx *sql.Tx, limit int) ([]*Event, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(
+		"SELECT id, topic, event_key, payload, headers, created_at FROM %s WHERE published_at IS NULL ORDER BY seq LIMIT ? FOR UPDATE",
+		outbox.table,
+	), limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get unpublished events")
+	}
+	defer rows.Close()
+
+	events := make([]*Event, 0, limit)
+	for rows.Next() {
+		var (
+			event     = &Event{}
+			headers   sql.NullString
+			createdAt int64
+		)
+		if err := rows.Scan(&event.ID, &event.Topic, &event.Key, &event.Payload, &headers, &createdAt); err != nil {
+			return nil, errors.Wrap(err, "failed to scan event")
+		}
+		if headers.Valid && headers.String != "" {
+			if err := json.Unmarshal([]byte(headers.String), &event.Headers); err != nil {
+				return nil, errors.Wrapf(err, "failed to unmarshal headers of event %s", event.ID)
+			}
+		}
+		event.CreatedAt = time.Unix(0, createdAt*int64(time.Millisecond)).UTC()
+		events = append(events, event)
+	}
+	return events, errors.Wrap(rows.Err(), "failed to get unpublished events")
+}
+
+// markPublished marks events as published
+func (outbox *Outbox) markPublished(ctx context.Context, tx *sql.Tx, events []*Event) error {
+	query := fmt.Sprintf("UPDATE %s SET published_at = ? WHERE id = ?", outbox.table)
+	now := unixMillis(time.Now())
+	for _, event := range events {
+		if _, err := tx.ExecContext(ctx, query, now, event.ID); err != nil {
+			return errors.Wrapf(err, "failed to mark event %s published", event.ID)
+		}
+	}
+	return nil
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,109 @@
+package events
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"regexp"
+	"testing"
+)
+
+func TestOutboxAdd(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	outbox, err := NewOutbox(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := New("accounts", "a", []byte(`{"id":"a"}`))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO event_outbox (id, topic, event_key, payload, headers, created_at)")).
+		WithArgs(event.ID, "accounts", "a", event.Payload, "null", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Add(context.Background(), tx, event); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := outbox.Add(context.Background(), db, &Event{Topic: "accounts"}); err == nil {
+		t.Errorf("expected an error for an event without an id")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := NewOutbox(db, "outbox; DROP TABLE accounts"); err == nil {
+		t.Errorf("expected an error for an invalid table name")
+	}
+}
+
+func TestRelay(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	outbox, err := NewOutbox(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := NewMemoryBroker()
+	relay, err := NewRelay(outbox, broker, nil, &RelayOptions{BatchSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selectPending := regexp.QuoteMeta(
+		"SELECT id, topic, event_key, payload, headers, created_at FROM event_outbox WHERE published_at IS NULL ORDER BY seq LIMIT ? FOR UPDATE",
+	)
+	markPublished := regexp.QuoteMeta("UPDATE event_outbox SET published_at = ? WHERE id = ?")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPending).WithArgs(10).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "topic", "event_key", "payload", "headers", "created_at"}).
+			AddRow("1", "accounts", "a", []byte("{}"), `{"source":"test"}`, 1600000000000).
+			AddRow("2", "payments", "p", []byte("{}"), nil, 1600000000001),
+	)
+	mock.ExpectExec(markPublished).WithArgs(sqlmock.AnyArg(), "1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(markPublished).WithArgs(sqlmock.AnyArg(), "2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := relay.RelayOnce(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("RelayOnce() = %d, %v", n, err)
+	}
+
+	accounts := broker.Events("accounts")
+	if len(accounts) != 1 || accounts[0].ID != "1" || accounts[0].Headers["source"] != "test" || accounts[0].CreatedAt.Unix() != 1600000000 {
+		t.Errorf("unexpected published events %+v", accounts)
+	}
+	if len(broker.Events("payments")) != 1 {
+		t.Errorf("payments event not published")
+	}
+
+	// nothing is published when the outbox is empty
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPending).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	if n, err := relay.RelayOnce(context.Background()); err != nil || n != 0 {
+		t.Errorf("RelayOnce() = %d, %v", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,173 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/gidyon/micros/pkg/worker"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisOptions contains options for the redis streams broker
+type RedisOptions struct {
+	// Prefix is prepended to topics to get stream names. Defaults to events:
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Consumer names this process in consumer groups. Defaults to hostname-pid
+	Consumer string `json:"consumer" yaml:"consumer"`
+	// MaxLen caps the length of streams approximately. Streams are not trimmed when zero
+	MaxLen int64 `json:"maxLen" yaml:"maxLen"`
+	// BatchSize is the maximum number of events read at a time. Defaults to 10
+	BatchSize int64 `json:"batchSize" yaml:"batchSize"`
+	// MaxRetries is how many times a failed event is retried before it is dead-lettered. Defaults to 5
+	MaxRetries int64 `json:"maxRetries" yaml:"maxRetries"`
+	// RetryDelay is how long a pending event stays idle before it is reclaimed, from this or a dead consumer.
+	// It must be longer than handlers take to run. Defaults to 30 seconds
+	RetryDelay time.Duration `json:"retryDelay" yaml:"retryDelay"`
+}
+
+// RedisBroker publishes events to redis streams and delivers them using consumer groups.
+// Subscribers are stream workers: events are acknowledged once handled, events whose handler fails or whose
+// consumer died are reclaimed after the retry delay and events failing more than MaxRetries times are moved
+// to the dead-letter stream of the topic, which is the topic stream suffixed with :dead
+type RedisBroker struct {
+	client     *redis.Client
+	logger     logging.Logger
+	prefix     string
+	consumer   string
+	maxLen     int64
+	batchSize  int64
+	maxRetries int64
+	retryDelay time.Duration
+}
+
+const defaultRedisPrefix = "events:"
+
+// NewRedisBroker creates a redis streams broker using client. Failed deliveries are logged with logger
+func NewRedisBroker(client *redis.Client, logger logging.Logger, opt *RedisOptions) (*RedisBroker, error) {
+	if client == nil {
+		return nil, errors.New("redis client must not be nil")
+	}
+	if opt == nil {
+		opt = &RedisOptions{}
+	}
+
+	broker := &RedisBroker{
+		client:     client,
+		logger:     logging.OrNop(logger),
+		prefix:     opt.Prefix,
+		consumer:   opt.Consumer,
+		maxLen:     opt.MaxLen,
+		batchSize:  opt.BatchSize,
+		maxRetries: opt.MaxRetries,
+		retryDelay: opt.RetryDelay,
+	}
+	if broker.prefix == "" {
+		broker.prefix = defaultRedisPrefix
+	}
+	return broker, nil
+}
+
+// Stream returns the name of the redis stream of topic
+func (broker *RedisBroker) Stream(topic string) string {
+	return broker.prefix + topic
+}
+
+// DeadLetterStream returns the name of the redis stream receiving the events of topic that failed too many times
+func (broker *RedisBroker) DeadLetterStream(topic string) string {
+	return broker.Stream(topic) + ":dead"
+}
+
+// Publish adds events to the streams of their topics
+func (broker *RedisBroker) Publish(ctx context.Context, events ...*Event) error {
+	client := broker.client.WithContext(ctx)
+	for _, event := range events {
+		values, err := encodeRedisEvent(event)
+		if err != nil {
+			return err
+		}
+		err = client.XAdd(&redis.XAddArgs{
+			Stream:       broker.Stream(event.Topic),
+			MaxLenApprox: broker.maxLen,
+			Values:       values,
+		}).Err()
+		if err != nil {
+			return errors.Wrapf(err, "failed to publish event %s", event.ID)
+		}
+	}
+	return nil
+}
+
+// Subscribe delivers the events of topic to handler until ctx is done. New groups start with the first event
+// of the stream. Events that cannot be decoded are dead-lettered without calling handler
+func (broker *RedisBroker) Subscribe(ctx context.Context, topic, group string, handler Handler) error {
+	w, err := worker.New(broker.client, &worker.Options{
+		Stream:           broker.Stream(topic),
+		Group:            group,
+		Consumer:         broker.consumer,
+		BatchSize:        broker.batchSize,
+		MaxRetries:       broker.maxRetries,
+		RetryDelay:       broker.retryDelay,
+		DeadLetterStream: broker.DeadLetterStream(topic),
+	}, func(ctx context.Context, msg *worker.Message) error {
+		event, err := decodeRedisEvent(topic, redis.XMessage{ID: msg.ID, Values: msg.Values})
+		if err != nil {
+			return worker.Permanent(err)
+		}
+		return handler(ctx, event)
+	}, broker.logger.With("topic", topic))
+	if err != nil {
+		return errors.Wrapf(err, "failed to subscribe to %s", topic)
+	}
+
+	return w.Run(ctx)
+}
+
+// CreateGroup creates the consumer group of stream if it does not exist. The stream is created if necessary
+func CreateGroup(ctx context.Context, client *redis.Client, stream, group string) error {
+	err := client.WithContext(ctx).XGroupCreateMkStream(stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrapf(err, "failed to create group %s for stream %s", group, stream)
+	}
+	return nil
+}
+
+func encodeRedisEvent(event *Event) (map[string]interface{}, error) {
+	headers, err := json.Marshal(event.Headers)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal event headers")
+	}
+	return map[string]interface{}{
+		"id":        event.ID,
+		"key":       event.Key,
+		"payload":   event.Payload,
+		"headers":   headers,
+		"createdAt": unixMillis(event.CreatedAt),
+	}, nil
+}
+
+func decodeRedisEvent(topic string, message redis.XMessage) (*Event, error) {
+	field := func(name string) string {
+		value, _ := message.Values[name].(string)
+		return value
+	}
+
+	event := &Event{
+		ID:      field("id"),
+		Topic:   topic,
+		Key:     field("key"),
+		Payload: []byte(field("payload")),
+	}
+	if headers := field("headers"); headers != "" && headers != "null" {
+		if err := json.Unmarshal([]byte(headers), &event.Headers); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal headers of event %s", message.ID)
+		}
+	}
+	if createdAt, err := strconv.ParseInt(field("createdAt"), 10, 64); err == nil {
+		event.CreatedAt = time.Unix(0, createdAt*int64(time.Millisecond)).UTC()
+	}
+	return event, nil
+}
@@ -0,0 +1,109 @@
+package events
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// RelayOptions contains options for publishing outbox events
+type RelayOptions struct {
+	// BatchSize is the maximum number of events published at a time. Defaults to 100
+	BatchSize int `json:"batchSize" yaml:"batchSize"`
+	// Interval is how often the outbox is polled when it is empty. Defaults to 1 second
+	Interval time.Duration `json:"interval" yaml:"interval"`
+}
+
+const (
+	defaultRelayBatchSize = 100
+	defaultRelayInterval  = time.Second
+)
+
+// Relay publishes outbox events in the order they were added
+type Relay struct {
+	outbox    *Outbox
+	publisher Publisher
+	logger    logging.Logger
+	batchSize int
+	interval  time.Duration
+}
+
+// NewRelay creates a relay publishing the events of outbox with publisher
+func NewRelay(outbox *Outbox, publisher Publisher, logger logging.Logger, opt *RelayOptions) (*Relay, error) {
+	switch {
+	case outbox == nil:
+		return nil, errors.New("relay outbox must not be nil")
+	case publisher == nil:
+		return nil, errors.New("relay publisher must not be nil")
+	}
+	if opt == nil {
+		opt = &RelayOptions{}
+	}
+
+	relay := &Relay{
+		outbox:    outbox,
+		publisher: publisher,
+		logger:    logging.OrNop(logger),
+		batchSize: opt.BatchSize,
+		interval:  opt.Interval,
+	}
+	if relay.batchSize <= 0 {
+		relay.batchSize = defaultRelayBatchSize
+	}
+	if relay.interval <= 0 {
+		relay.interval = defaultRelayInterval
+	}
+	return relay, nil
+}
+
+// RelayOnce publishes one batch of unpublished events and returns how many were published.
+// The batch is locked while it is published so that concurrent relays don't publish the same events
+func (relay *Relay) RelayOnce(ctx context.Context) (int, error) {
+	tx, err := relay.outbox.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	events, err := relay.outbox.pending(ctx, tx, relay.batchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	if err := relay.publisher.Publish(ctx, events...); err != nil {
+		return 0, errors.Wrap(err, "failed to publish events")
+	}
+
+	if err := relay.outbox.markPublished(ctx, tx, events); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "failed to commit published events")
+	}
+
+	return len(events), nil
+}
+
+// Run publishes events until ctx is done. Failures are logged and retried after the interval
+func (relay *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := relay.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			relay.logger.Error("failed to relay outbox events", "error", err)
+		}
+
+		// full batches are followed immediately by the next one
+		if err == nil && n == relay.batchSize {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		if !sleep(ctx, relay.interval) {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Package gateway contains grpc-gateway runtime mux options for micros services.
+//
+// grpc-gateway v1 is used by default. Build with the gatewayv2 tag to use grpc-gateway v2 and protojson.
+// The JSON written to clients stays the same, including error bodies, except for google.protobuf.FieldMask
+// which protojson writes as a string of comma separated camelCase paths instead of {"paths": [...]}.
+package gateway
+
+import (
+	"encoding/json"
+	"github.com/gidyon/micros/pkg/requestid"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// MIMEProtobuf and MIMEForm are the content types served by WithProtoMarshaler and WithFormMarshaler
+const (
+	MIMEProtobuf = "application/x-protobuf"
+	MIMEForm     = "application/x-www-form-urlencoded"
+)
+
+func canonicalSet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[textproto.CanonicalMIMEHeaderKey(key)] = struct{}{}
+	}
+	return set
+}
+
+// ErrorBody is the JSON body written for failed gateway calls
+type ErrorBody struct {
+	// Code is the gRPC status code
+	Code int32 `json:"code"`
+	// Status is the name of the gRPC status code e.g NOT_FOUND
+	Status    string            `json:"status"`
+	Message   string            `json:"message"`
+	Details   []json.RawMessage `json:"details,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+}
+
+// writeErrorBody writes st as an ErrorBody. Details are encoded using marshal
+func writeErrorBody(
+	w http.ResponseWriter, r *http.Request, st *status.Status, httpStatus int, marshal func(interface{}) ([]byte, error),
+) {
+	body := &ErrorBody{
+		Code:    int32(st.Code()),
+		Status:  codeName(st.Code().String()),
+		Message: st.Message(),
+	}
+
+	for _, detail := range st.Proto().GetDetails() {
+		data, err := marshal(detail)
+		if err == nil {
+			body.Details = append(body.Details, data)
+		}
+	}
+
+	if id, ok := requestid.FromContext(r.Context()); ok {
+		body.RequestID = id
+	} else if id := r.Header.Get(requestid.HeaderKey); id != "" {
+		body.RequestID = id
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		data = []byte(`{"code":13,"status":"INTERNAL","message":"failed to marshal error"}`)
+	}
+
+	w.Header().Del("Trailer")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	w.Write(data)
+}
+
+// codeName converts a code name like NotFound to NOT_FOUND
+func codeName(name string) string {
+	var b strings.Builder
+	prevLower := false
+	for _, r := range name {
+		upper := r >= 'A' && r <= 'Z'
+		if upper && prevLower {
+			b.WriteByte('_')
+		}
+		prevLower = !upper
+		b.WriteRune(r)
+	}
+	return strings.ToUpper(b.String())
+}
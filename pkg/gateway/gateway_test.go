@@ -0,0 +1,124 @@
+package gateway
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/gidyon/micros/pkg/errs"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorHandler(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+
+	ErrorHandler(
+		context.Background(), nil, JSONMarshaler(),
+		w, r, status.Error(codes.NotFound, "account not found"),
+	)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	body := &ErrorBody{}
+	if err := json.Unmarshal(w.Body.Bytes(), body); err != nil {
+		t.Fatalf("failed to decode body %s: %v", w.Body, err)
+	}
+
+	want := &ErrorBody{Code: 5, Status: "NOT_FOUND", Message: "account not found", RequestID: "abc-123"}
+	if body.Code != want.Code || body.Status != want.Status || body.Message != want.Message || body.RequestID != want.RequestID {
+		t.Errorf("body = %+v, want %+v", body, want)
+	}
+}
+
+func TestErrorHandlerDomainErrors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		want   ErrorBody
+	}{
+		{
+			err:    errs.Conflict("account was modified"),
+			status: http.StatusConflict,
+			want:   ErrorBody{Code: 10, Status: "ABORTED", Message: "account was modified"},
+		},
+		{
+			err:    errors.Wrap(sql.ErrNoRows, "failed to get account"),
+			status: http.StatusNotFound,
+			want:   ErrorBody{Code: 5, Status: "NOT_FOUND", Message: "not found"},
+		},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		ErrorHandler(context.Background(), nil, JSONMarshaler(), w, httptest.NewRequest(http.MethodGet, "/", nil), tt.err)
+
+		body := ErrorBody{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode body %s: %v", w.Body, err)
+		}
+		if w.Code != tt.status || body.Code != tt.want.Code || body.Status != tt.want.Status || body.Message != tt.want.Message {
+			t.Errorf("%v: got %d %+v, want %d %+v", tt.err, w.Code, body, tt.status, tt.want)
+		}
+	}
+}
+
+func TestCodeName(t *testing.T) {
+	tests := map[codes.Code]string{
+		codes.OK:                 "OK",
+		codes.NotFound:           "NOT_FOUND",
+		codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+		codes.FailedPrecondition: "FAILED_PRECONDITION",
+		codes.Unauthenticated:    "UNAUTHENTICATED",
+	}
+	for code, want := range tests {
+		if got := codeName(code.String()); got != want {
+			t.Errorf("codeName(%s) = %s, want %s", code, got, want)
+		}
+	}
+}
+
+func TestFormMarshaler(t *testing.T) {
+	fm := &FormMarshaler{}
+	msg := &wrappers.StringValue{}
+	if err := fm.Unmarshal([]byte("value=hello+world"), msg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if msg.Value != "hello world" {
+		t.Errorf("value = %q, want %q", msg.Value, "hello world")
+	}
+}
+
+func TestHeaderMatchers(t *testing.T) {
+	incoming := RequestHeaderMatcher("X-Tenant-ID")
+	tests := []struct {
+		key    string
+		want   string
+		wantOk bool
+	}{
+		{key: "x-tenant-id", want: "x-tenant-id", wantOk: true},
+		{key: "Authorization", want: "grpcgateway-Authorization", wantOk: true},
+		{key: "X-Other", want: "", wantOk: false},
+	}
+	for _, tt := range tests {
+		got, ok := incoming(tt.key)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("incoming(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOk)
+		}
+	}
+
+	outgoing := ResponseHeaderMatcher("x-next-page")
+	if got, _ := outgoing("x-next-page"); got != "X-Next-Page" {
+		t.Errorf("outgoing(x-next-page) = %q, want X-Next-Page", got)
+	}
+	if got, _ := outgoing("x-other"); got != "Grpc-Metadata-x-other" {
+		t.Errorf("outgoing(x-other) = %q, want Grpc-Metadata-x-other", got)
+	}
+}
@@ -0,0 +1,147 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The golden files hold the JSON written by grpc-gateway v1. Run the tests with and without the
+// gatewayv2 tag to check that both versions write the same JSON
+var update = flag.Bool("update", false, "update golden files")
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	// protojson randomly adds whitespace so only the compacted JSON is compared
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, got); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	got = append(compacted.Bytes(), '\n')
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("JSON for %s differs from golden file\ngot:  %s\nwant: %s", name, got, want)
+	}
+}
+
+func TestJSONMarshalerGolden(t *testing.T) {
+	fields, err := structpb.NewStruct(map[string]interface{}{
+		"name":   "Jane",
+		"age":    30,
+		"active": true,
+		"tags":   []interface{}{"admin", "owner"},
+		"meta":   nil,
+	})
+	if err != nil {
+		t.Fatalf("failed to create struct: %v", err)
+	}
+
+	timestamp := timestamppb.New(time.Date(2020, 3, 14, 15, 9, 26, 535000000, time.UTC))
+	any, err := anypb.New(timestamp)
+	if err != nil {
+		t.Fatalf("failed to create any: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		msg  proto.Message
+	}{
+		// Fields with default values are included and use their proto names
+		{name: "defaults", msg: &typepb.Type{Name: "Account"}},
+		{name: "method", msg: &apipb.Method{
+			Name:              "GetAccount",
+			RequestTypeUrl:    "type.googleapis.com/account.GetAccountRequest",
+			ResponseStreaming: true,
+			Syntax:            typepb.Syntax_SYNTAX_PROTO3,
+		}},
+		{name: "struct", msg: fields},
+		{name: "timestamp", msg: timestamp},
+		{name: "duration", msg: durationpb.New(90 * time.Second)},
+		{name: "int64", msg: wrapperspb.Int64(9007199254740993)},
+		{name: "any", msg: any},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := JSONMarshaler().Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			checkGolden(t, tt.name, data)
+		})
+	}
+}
+
+func TestDefaultErrorHandlerGolden(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "invalid account").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "email", Description: "must be a valid email"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to add details: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "error", err: status.Error(codes.NotFound, "account not found")},
+		{name: "error_details", err: st.Err()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			w := httptest.NewRecorder()
+
+			DefaultErrorHandler(context.Background(), nil, JSONMarshaler(), w, r, tt.err)
+
+			if w.Code != runtimeStatus(tt.err) {
+				t.Errorf("status = %d, want %d", w.Code, runtimeStatus(tt.err))
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			checkGolden(t, tt.name, w.Body.Bytes())
+		})
+	}
+}
+
+func runtimeStatus(err error) int {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,194 @@
+//go:build gatewayv2
+// +build gatewayv2
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gidyon/micros/pkg/errs"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// JSONMarshaler returns the marshaler used for JSON requests and responses.
+// Fields use their proto names and fields with default values are included, as with grpc-gateway v1
+func JSONMarshaler() runtime.Marshaler {
+	return &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{
+			UseProtoNames:   true,
+			EmitUnpopulated: true,
+		},
+	}
+}
+
+// DefaultErrorHandler writes errors as {"error", "code", "message", "details"} like grpc-gateway v1
+// instead of the google.rpc.Status body written by runtime.DefaultHTTPErrorHandler.
+// Domain errors are translated with errs.Translate
+func DefaultErrorHandler(
+	ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler,
+	w http.ResponseWriter, r *http.Request, err error,
+) {
+	runtime.DefaultHTTPErrorHandler(ctx, mux, &v1ErrorMarshaler{marshaler}, w, r, errs.Translate(err))
+}
+
+// RoutingErrorHandler writes the HTTP status text for requests that match no route like grpc-gateway v1
+func RoutingErrorHandler(
+	ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler,
+	w http.ResponseWriter, r *http.Request, httpStatus int,
+) {
+	http.Error(w, http.StatusText(httpStatus), httpStatus)
+}
+
+// DefaultServeMuxOptions returns the options every service runtime mux starts with
+func DefaultServeMuxOptions() []runtime.ServeMuxOption {
+	return []runtime.ServeMuxOption{
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, JSONMarshaler()),
+		runtime.WithErrorHandler(DefaultErrorHandler),
+		runtime.WithRoutingErrorHandler(RoutingErrorHandler),
+	}
+}
+
+// v1ErrorBody has the fields of the grpc-gateway v1 error message in the same order
+type v1ErrorBody struct {
+	Error   string            `json:"error"`
+	Code    int32             `json:"code"`
+	Message string            `json:"message"`
+	Details []json.RawMessage `json:"details"`
+}
+
+// v1ErrorMarshaler marshals JSON error statuses as a v1ErrorBody
+type v1ErrorMarshaler struct {
+	runtime.Marshaler
+}
+
+func (m *v1ErrorMarshaler) Marshal(v interface{}) ([]byte, error) {
+	st, ok := v.(*spb.Status)
+	if !ok || m.ContentType(v) != "application/json" {
+		return m.Marshaler.Marshal(v)
+	}
+
+	body := &v1ErrorBody{
+		Error:   st.GetMessage(),
+		Code:    st.GetCode(),
+		Message: st.GetMessage(),
+		Details: make([]json.RawMessage, 0, len(st.GetDetails())),
+	}
+	for _, detail := range st.GetDetails() {
+		data, err := m.Marshaler.Marshal(detail)
+		if err != nil {
+			return nil, err
+		}
+		body.Details = append(body.Details, data)
+	}
+
+	return json.Marshal(body)
+}
+
+// ForwardRequestHeaders forwards the given HTTP request headers to the gRPC server as metadata
+// with the same lower-cased names. Other headers are matched by runtime.DefaultHeaderMatcher
+func ForwardRequestHeaders(headers ...string) runtime.ServeMuxOption {
+	return runtime.WithIncomingHeaderMatcher(RequestHeaderMatcher(headers...))
+}
+
+// ForwardResponseHeaders sends the given gRPC response metadata keys to HTTP clients as headers
+// with the same names. Other keys are sent with the Grpc-Metadata- prefix
+func ForwardResponseHeaders(keys ...string) runtime.ServeMuxOption {
+	return runtime.WithOutgoingHeaderMatcher(ResponseHeaderMatcher(keys...))
+}
+
+// RequestHeaderMatcher is the incoming header matcher used by ForwardRequestHeaders
+func RequestHeaderMatcher(headers ...string) runtime.HeaderMatcherFunc {
+	allowed := canonicalSet(headers)
+	return func(key string) (string, bool) {
+		if _, ok := allowed[textproto.CanonicalMIMEHeaderKey(key)]; ok {
+			return strings.ToLower(key), true
+		}
+		return runtime.DefaultHeaderMatcher(key)
+	}
+}
+
+// ResponseHeaderMatcher is the outgoing header matcher used by ForwardResponseHeaders
+func ResponseHeaderMatcher(keys ...string) runtime.HeaderMatcherFunc {
+	allowed := canonicalSet(keys)
+	return func(key string) (string, bool) {
+		header := textproto.CanonicalMIMEHeaderKey(key)
+		if _, ok := allowed[header]; ok {
+			return header, true
+		}
+		return runtime.MetadataHeaderPrefix + key, true
+	}
+}
+
+// WithErrorBody makes the gateway write errors as an ErrorBody with the HTTP status mapped from the gRPC code.
+// Requests that match no route get an ErrorBody too
+func WithErrorBody() runtime.ServeMuxOption {
+	return func(mux *runtime.ServeMux) {
+		runtime.WithErrorHandler(ErrorHandler)(mux)
+		runtime.WithRoutingErrorHandler(runtime.DefaultRoutingErrorHandler)(mux)
+	}
+}
+
+// ErrorHandler writes err as an ErrorBody. Domain errors are translated with errs.Status. It can be used with runtime.WithErrorHandler
+func ErrorHandler(
+	ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler,
+	w http.ResponseWriter, r *http.Request, err error,
+) {
+	st := errs.Status(err)
+	writeErrorBody(w, r, st, runtime.HTTPStatusFromCode(st.Code()), marshaler.Marshal)
+}
+
+// WithProtoMarshaler serves protobuf binary to clients that send or accept application/x-protobuf
+func WithProtoMarshaler() runtime.ServeMuxOption {
+	return runtime.WithMarshalerOption(MIMEProtobuf, &runtime.ProtoMarshaller{})
+}
+
+// WithFormMarshaler accepts application/x-www-form-urlencoded request bodies. Responses are JSON
+func WithFormMarshaler() runtime.ServeMuxOption {
+	return runtime.WithMarshalerOption(MIMEForm, &FormMarshaler{
+		JSONPb: runtime.JSONPb{
+			MarshalOptions: protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+		},
+	})
+}
+
+// FormMarshaler decodes form encoded bodies into protobuf messages like query parameters
+// and encodes responses as JSON
+type FormMarshaler struct {
+	runtime.JSONPb
+}
+
+// Unmarshal parses data as a form into v which must be a proto.Message
+func (fm *FormMarshaler) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "form body can only be decoded into a protobuf message, got %T", v)
+	}
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	return runtime.PopulateQueryParameters(msg, values, utilities.NewDoubleArray(nil))
+}
+
+// NewDecoder returns a decoder that reads a form from r
+func (fm *FormMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return fm.Unmarshal(data, v)
+	})
+}
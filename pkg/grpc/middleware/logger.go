@@ -1,12 +1,19 @@
 package middleware
 
 import (
+	"context"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/gidyon/micros/pkg/requestid"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 	"github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"path"
+	"sort"
+	"time"
 )
 
 // codeToLevel redirects OK to DEBUG level logging instead of INFO
@@ -19,23 +26,31 @@ func codeToLevel(code codes.Code) zapcore.Level {
 	return grpc_zap.DefaultCodeToLevel(code)
 }
 
-// AddLogging returns grpc.Server config option that turn on logging.
+// AddLogging returns interceptors that log every call with its code and duration. Zap loggers log through
+// grpc_zap; other backends log the same fields through logger.
+// The request id is logged when it was read into the context by an earlier interceptor, as InitGRPC does
 func AddLogging(
-	logger *zap.Logger,
+	logger logging.Logger,
 ) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
-	// Shared options for the logger, with a custom gRPC code to log level function.
-	o := []grpc_zap.Option{
-		grpc_zap.WithLevels(codeToLevel),
+	logger = logging.OrNop(logger)
+
+	unaryLogger, streamLogger := unaryCallLogger(logger), streamCallLogger(logger)
+	if zapLogger, ok := logging.Zap(logger); ok {
+		// Shared options for the logger, with a custom gRPC code to log level function.
+		o := []grpc_zap.Option{
+			grpc_zap.WithLevels(codeToLevel),
+		}
+		unaryLogger = grpc_zap.UnaryServerInterceptor(zapLogger, o...)
+		streamLogger = grpc_zap.StreamServerInterceptor(zapLogger, o...)
 	}
-	// Make sure that log statements internal to gRPC library are logged using the zapLogger as well.
-	grpc_zap.ReplaceGrpcLogger(logger)
 
 	// Add unary interceptors
 	unaryInterceptors := []grpc.UnaryServerInterceptor{
 		grpc_ctxtags.UnaryServerInterceptor(
 			grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor),
 		),
-		grpc_zap.UnaryServerInterceptor(logger, o...),
+		unaryRequestIDTag,
+		unaryLogger,
 	}
 
 	// Add stream interceptors
@@ -43,8 +58,96 @@ func AddLogging(
 		grpc_ctxtags.StreamServerInterceptor(
 			grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor),
 		),
-		grpc_zap.StreamServerInterceptor(logger, o...),
+		streamRequestIDTag,
+		streamLogger,
 	}
 
 	return unaryInterceptors, streamInterceptors
 }
+
+// unaryCallLogger logs finished unary calls with the fields grpc_zap logs
+func unaryCallLogger(logger logging.Logger) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, logger, "finished unary call with code ", info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// streamCallLogger logs finished streams with the fields grpc_zap logs
+func streamCallLogger(logger logging.Logger) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), logger, "finished streaming call with code ", info.FullMethod, start, err)
+		return err
+	}
+}
+
+func logCall(ctx context.Context, logger logging.Logger, msg, fullMethod string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := append(tagFields(ctx),
+		"grpc.service", path.Dir(fullMethod)[1:],
+		"grpc.method", path.Base(fullMethod),
+		"grpc.code", code.String(),
+		"grpc.time_ms", float32(time.Since(start).Nanoseconds()/1000)/1000,
+	)
+	if err != nil {
+		fields = append(fields, "error", err)
+	}
+
+	switch logging.Level(codeToLevel(code)) {
+	case logging.LevelDebug:
+		logger.Debug(msg+code.String(), fields...)
+	case logging.LevelInfo:
+		logger.Info(msg+code.String(), fields...)
+	case logging.LevelWarn:
+		logger.Warn(msg+code.String(), fields...)
+	default:
+		logger.Error(msg+code.String(), fields...)
+	}
+}
+
+// tagFields returns the tags of the call such as the request id as sorted keys and values
+func tagFields(ctx context.Context) []interface{} {
+	tags := grpc_ctxtags.Extract(ctx).Values()
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]interface{}, 0, 2*len(keys)+8)
+	for _, key := range keys {
+		fields = append(fields, key, tags[key])
+	}
+	return fields
+}
+
+// requestIDTag is the log field holding the request id
+const requestIDTag = "request.id"
+
+// unaryRequestIDTag adds the request id to the tags logged with every line of the call
+func unaryRequestIDTag(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if id, ok := requestid.FromContext(ctx); ok {
+		grpc_ctxtags.Extract(ctx).Set(requestIDTag, id)
+	}
+	return handler(ctx, req)
+}
+
+// streamRequestIDTag adds the request id to the tags logged with every line of the stream
+func streamRequestIDTag(
+	srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	if id, ok := requestid.FromContext(ss.Context()); ok {
+		grpc_ctxtags.Extract(ss.Context()).Set(requestIDTag, id)
+	}
+	return handler(srv, ss)
+}
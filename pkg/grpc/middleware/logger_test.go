@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/gidyon/micros/pkg/requestid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"testing"
+)
+
+// callWithLogging runs a unary call returning err through the interceptors returned by AddLogging
+func callWithLogging(t *testing.T, logger logging.Logger, err error) {
+	unary, _ := AddLogging(logger)
+
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, err
+	}
+	for i := len(unary) - 1; i >= 0; i-- {
+		interceptor, next := unary[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/account.Account/Get"}, next)
+		}
+	}
+	if _, got := handler(ctx, nil); got != err {
+		t.Errorf("call error = %v, want %v", got, err)
+	}
+}
+
+func TestAddLoggingZap(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	callWithLogging(t, logging.NewZap(zap.New(core)), status.Error(codes.Internal, "failed"))
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d log entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if entries[0].Level != zapcore.ErrorLevel || fields["grpc.code"] != "Internal" || fields[requestIDTag] != "req-1" {
+		t.Errorf("unexpected log entry %v with fields %v", entries[0].Entry, fields)
+	}
+}
+
+func TestAddLoggingOtherBackends(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		level string
+	}{
+		{name: "ok", level: "DEBUG"},
+		{name: "not found", err: status.Error(codes.NotFound, "missing"), level: "INFO"},
+		{name: "internal", err: status.Error(codes.Internal, "failed"), level: "ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			logger := slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			callWithLogging(t, logging.NewSlog(logger), tt.err)
+
+			entry := map[string]interface{}{}
+			if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+				t.Fatalf("failed to decode %s: %v", out, err)
+			}
+			if entry["level"] != tt.level || entry["grpc.code"] != status.Code(tt.err).String() ||
+				entry["grpc.method"] != "Get" || entry[requestIDTag] != "req-1" {
+				t.Errorf("unexpected log entry %v", entry)
+			}
+		})
+	}
+}
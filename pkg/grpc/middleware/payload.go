@@ -0,0 +1,281 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+)
+
+// PayloadLoggingOptions contains options for logging request and response messages
+type PayloadLoggingOptions struct {
+	// Methods are the full gRPC method names whose payloads are logged e.g /account.AccountAPI/GetAccount.
+	// A trailing * matches any suffix e.g /account.AccountAPI/*. All methods are logged when empty
+	Methods []string `json:"methods" yaml:"methods"`
+	// RedactFields are fields whose values are masked. A path with dots e.g user.credentials.token is
+	// matched from the message root while a name without dots e.g password matches at any depth.
+	// Fields marked with a bool field option named sensitive are always masked
+	RedactFields []string `json:"redactFields" yaml:"redactFields"`
+	// MaxBytes is the maximum size of a logged payload; longer payloads are truncated. Defaults to 4096
+	MaxBytes int `json:"maxBytes" yaml:"maxBytes"`
+}
+
+const (
+	defaultMaxPayloadBytes = 4096
+	redactedValue          = "REDACTED"
+)
+
+type payloadLogger struct {
+	logger      logging.Logger
+	methods     map[string]struct{}
+	prefixes    []string
+	redactPaths map[string]struct{}
+	redactNames map[string]struct{}
+	maxBytes    int
+}
+
+// AddPayloadLogging returns interceptors that log request and response messages at debug level
+// with sensitive fields masked. They should be added after the interceptors returned by AddLogging
+func AddPayloadLogging(
+	logger logging.Logger, opt *PayloadLoggingOptions,
+) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
+	pl := newPayloadLogger(logger, opt)
+	return []grpc.UnaryServerInterceptor{pl.unaryInterceptor}, []grpc.StreamServerInterceptor{pl.streamInterceptor}
+}
+
+func newPayloadLogger(logger logging.Logger, opt *PayloadLoggingOptions) *payloadLogger {
+	if opt == nil {
+		opt = &PayloadLoggingOptions{}
+	}
+
+	pl := &payloadLogger{
+		logger:      logging.OrNop(logger),
+		methods:     make(map[string]struct{}),
+		redactPaths: make(map[string]struct{}),
+		redactNames: make(map[string]struct{}),
+		maxBytes:    opt.MaxBytes,
+	}
+	if pl.maxBytes <= 0 {
+		pl.maxBytes = defaultMaxPayloadBytes
+	}
+
+	for _, method := range opt.Methods {
+		if strings.HasSuffix(method, "*") {
+			pl.prefixes = append(pl.prefixes, strings.TrimSuffix(method, "*"))
+		} else {
+			pl.methods[method] = struct{}{}
+		}
+	}
+
+	for _, field := range opt.RedactFields {
+		if strings.Contains(field, ".") {
+			pl.redactPaths[field] = struct{}{}
+		} else {
+			pl.redactNames[field] = struct{}{}
+		}
+	}
+
+	return pl
+}
+
+func (pl *payloadLogger) enabled(fullMethod string) bool {
+	if len(pl.methods) == 0 && len(pl.prefixes) == 0 {
+		return true
+	}
+	if _, ok := pl.methods[fullMethod]; ok {
+		return true
+	}
+	for _, prefix := range pl.prefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (pl *payloadLogger) log(ctx context.Context, fullMethod, msg string, payload interface{}) {
+	// Tags such as the request id are logged with the payload
+	fields := append(tagFields(ctx), "grpc.method", fullMethod, "grpc.content", pl.marshal(payload))
+
+	pl.logger.Debug(msg, fields...)
+}
+
+func (pl *payloadLogger) unaryInterceptor(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if !pl.enabled(info.FullMethod) || !pl.logger.Enabled(logging.LevelDebug) {
+		return handler(ctx, req)
+	}
+
+	pl.log(ctx, info.FullMethod, "server request payload", req)
+
+	resp, err := handler(ctx, req)
+	if err == nil {
+		pl.log(ctx, info.FullMethod, "server response payload", resp)
+	}
+
+	return resp, err
+}
+
+func (pl *payloadLogger) streamInterceptor(
+	srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	if !pl.enabled(info.FullMethod) || !pl.logger.Enabled(logging.LevelDebug) {
+		return handler(srv, ss)
+	}
+	return handler(srv, &payloadServerStream{ServerStream: ss, pl: pl, fullMethod: info.FullMethod})
+}
+
+// payloadServerStream logs the messages sent and received on a stream
+type payloadServerStream struct {
+	grpc.ServerStream
+	pl         *payloadLogger
+	fullMethod string
+}
+
+func (ss *payloadServerStream) SendMsg(m interface{}) error {
+	err := ss.ServerStream.SendMsg(m)
+	if err == nil {
+		ss.pl.log(ss.Context(), ss.fullMethod, "server response payload", m)
+	}
+	return err
+}
+
+func (ss *payloadServerStream) RecvMsg(m interface{}) error {
+	err := ss.ServerStream.RecvMsg(m)
+	if err == nil {
+		ss.pl.log(ss.Context(), ss.fullMethod, "server request payload", m)
+	}
+	return err
+}
+
+// marshal returns payload as JSON with sensitive fields masked and truncated to the maximum size
+func (pl *payloadLogger) marshal(payload interface{}) string {
+	msg, ok := payload.(proto.Message)
+	if !ok {
+		return fmt.Sprintf("<%T is not a protobuf message>", payload)
+	}
+
+	// The message is cloned since it is still used by the handler
+	clone := protov2.Clone(proto.MessageV2(msg))
+	pl.redact(clone.ProtoReflect(), "")
+
+	data, err := protojson.Marshal(clone)
+	if err != nil {
+		return fmt.Sprintf("<failed to marshal %T: %v>", payload, err)
+	}
+
+	if len(data) > pl.maxBytes {
+		return fmt.Sprintf("%s...(truncated %d bytes)", data[:pl.maxBytes], len(data)-pl.maxBytes)
+	}
+	return string(data)
+}
+
+// redact masks sensitive fields of msg. prefix is the path of msg from the root message
+func (pl *payloadLogger) redact(msg protoreflect.Message, prefix string) {
+	masked := make([]protoreflect.FieldDescriptor, 0)
+
+	msg.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		path := string(fd.Name())
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+
+		if pl.sensitive(fd, path) {
+			masked = append(masked, fd)
+			return true
+		}
+
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				pl.redact(list.Get(i).Message(), path)
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				pl.redact(v.Message(), path)
+				return true
+			})
+		case fd.Message() != nil && !fd.IsList() && !fd.IsMap():
+			pl.redact(value.Message(), path)
+		}
+
+		return true
+	})
+
+	// Fields are masked after ranging since msg must not be modified while ranging over it
+	for _, fd := range masked {
+		maskField(msg, fd, msg.Get(fd))
+	}
+}
+
+func (pl *payloadLogger) sensitive(fd protoreflect.FieldDescriptor, path string) bool {
+	if _, ok := pl.redactNames[string(fd.Name())]; ok {
+		return true
+	}
+	if _, ok := pl.redactPaths[path]; ok {
+		return true
+	}
+	return hasSensitiveOption(fd)
+}
+
+// hasSensitiveOption reports whether the field has a bool option named sensitive set to true
+// e.g string password = 1 [(myapp.sensitive) = true];
+func hasSensitiveOption(fd protoreflect.FieldDescriptor) bool {
+	options, ok := fd.Options().(protov2.Message)
+	if !ok || options == nil {
+		return false
+	}
+	sensitive := false
+	options.ProtoReflect().Range(func(opt protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if opt.IsExtension() && opt.Name() == "sensitive" && opt.Kind() == protoreflect.BoolKind && value.Bool() {
+			sensitive = true
+			return false
+		}
+		return true
+	})
+	return sensitive
+}
+
+// maskField replaces string and bytes values with REDACTED and clears fields of other kinds
+func maskField(msg protoreflect.Message, fd protoreflect.FieldDescriptor, value protoreflect.Value) {
+	if fd.IsMap() {
+		msg.Clear(fd)
+		return
+	}
+
+	mask := func(v protoreflect.Value) (protoreflect.Value, bool) {
+		switch fd.Kind() {
+		case protoreflect.StringKind:
+			return protoreflect.ValueOfString(redactedValue), true
+		case protoreflect.BytesKind:
+			return protoreflect.ValueOfBytes([]byte(redactedValue)), true
+		}
+		return v, false
+	}
+
+	if fd.IsList() {
+		list := value.List()
+		for i := 0; i < list.Len(); i++ {
+			masked, ok := mask(list.Get(i))
+			if !ok {
+				msg.Clear(fd)
+				return
+			}
+			list.Set(i, masked)
+		}
+		return
+	}
+
+	if masked, ok := mask(value); ok {
+		msg.Set(fd, masked)
+		return
+	}
+	msg.Clear(fd)
+}
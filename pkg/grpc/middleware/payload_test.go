@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/sourcecontextpb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"strings"
+	"testing"
+)
+
+func newAccountType() *typepb.Type {
+	return &typepb.Type{
+		Name: "Account",
+		Fields: []*typepb.Field{
+			{Name: "password", TypeUrl: "string", DefaultValue: "hunter2"},
+			{Name: "email", TypeUrl: "string"},
+		},
+		Oneofs:        []string{"credentials"},
+		SourceContext: &sourcecontextpb.SourceContext{FileName: "account.proto"},
+	}
+}
+
+func TestPayloadRedaction(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		check  func(t *testing.T, got *typepb.Type)
+	}{
+		{
+			name:   "field name at any depth",
+			fields: []string{"default_value"},
+			check: func(t *testing.T, got *typepb.Type) {
+				if got.Fields[0].DefaultValue != redactedValue {
+					t.Errorf("default_value = %q, want %q", got.Fields[0].DefaultValue, redactedValue)
+				}
+			},
+		},
+		{
+			name:   "field path from root",
+			fields: []string{"source_context.file_name", "fields.name"},
+			check: func(t *testing.T, got *typepb.Type) {
+				if got.SourceContext.FileName != redactedValue {
+					t.Errorf("source_context.file_name = %q, want %q", got.SourceContext.FileName, redactedValue)
+				}
+				if got.Fields[1].Name != redactedValue || got.Name != "Account" {
+					t.Errorf("only fields.name must be masked, got %v", got)
+				}
+			},
+		},
+		{
+			name:   "repeated strings",
+			fields: []string{"oneofs"},
+			check: func(t *testing.T, got *typepb.Type) {
+				if len(got.Oneofs) != 1 || got.Oneofs[0] != redactedValue {
+					t.Errorf("oneofs = %v, want [%s]", got.Oneofs, redactedValue)
+				}
+			},
+		},
+		{
+			name:   "message fields are cleared",
+			fields: []string{"source_context"},
+			check: func(t *testing.T, got *typepb.Type) {
+				if got.SourceContext != nil {
+					t.Errorf("source_context = %v, want nil", got.SourceContext)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := newAccountType()
+			pl := newPayloadLogger(logging.Nop(), &PayloadLoggingOptions{RedactFields: tt.fields})
+
+			got := &typepb.Type{}
+			if err := protojson.Unmarshal([]byte(pl.marshal(msg)), got); err != nil {
+				t.Fatalf("failed to decode logged payload: %v", err)
+			}
+			tt.check(t, got)
+
+			if !proto.Equal(msg, newAccountType()) {
+				t.Errorf("marshal() modified the logged message")
+			}
+		})
+	}
+}
+
+func TestPayloadTruncation(t *testing.T) {
+	pl := newPayloadLogger(logging.Nop(), &PayloadLoggingOptions{MaxBytes: 10})
+	got := pl.marshal(newAccountType())
+	if !strings.HasPrefix(got, `{"name":"A`) || !strings.Contains(got, "...(truncated ") {
+		t.Errorf("marshal() = %s, want truncated payload", got)
+	}
+}
+
+// sensitiveMessage builds a message type whose password field has a (test.sensitive) = true option
+func sensitiveMessage(t *testing.T) protoreflect.Message {
+	optionsFile, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test/options.proto"),
+		Package:    proto.String("test"),
+		Dependency: []string{"google/protobuf/descriptor.proto"},
+		Extension: []*descriptorpb.FieldDescriptorProto{{
+			Name:     proto.String("sensitive"),
+			Number:   proto.Int32(50000),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum(),
+			Extendee: proto.String(".google.protobuf.FieldOptions"),
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("failed to build options file: %v", err)
+	}
+
+	passwordOptions := &descriptorpb.FieldOptions{}
+	proto.SetExtension(passwordOptions, dynamicpb.NewExtensionType(optionsFile.Extensions().Get(0)), true)
+
+	files := &protoregistry.Files{}
+	files.RegisterFile(optionsFile)
+	loginFile, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test/login.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"test/options.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("LoginRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("username"),
+					JsonName: proto.String("username"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+				{
+					Name:     proto.String("password"),
+					JsonName: proto.String("password"),
+					Number:   proto.Int32(2),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					Options:  passwordOptions,
+				},
+			},
+		}},
+	}, files)
+	if err != nil {
+		t.Fatalf("failed to build login file: %v", err)
+	}
+
+	desc := loginFile.Messages().Get(0)
+	msg := dynamicpb.NewMessage(desc)
+	msg.Set(desc.Fields().ByName("username"), protoreflect.ValueOfString("jane"))
+	msg.Set(desc.Fields().ByName("password"), protoreflect.ValueOfString("hunter2"))
+	return msg
+}
+
+func TestPayloadSensitiveOption(t *testing.T) {
+	pl := newPayloadLogger(logging.Nop(), nil)
+	got := pl.marshal(sensitiveMessage(t))
+
+	if strings.Contains(got, "hunter2") || !strings.Contains(got, `"password":"REDACTED"`) {
+		t.Errorf("marshal() = %s, want password masked", got)
+	}
+	if !strings.Contains(got, `"username":"jane"`) {
+		t.Errorf("marshal() = %s, want username logged", got)
+	}
+}
+
+func TestPayloadLoggingMethods(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	unary, _ := AddPayloadLogging(logging.NewZap(zap.New(core)), &PayloadLoggingOptions{
+		Methods: []string{"/account.AccountAPI/*"}, RedactFields: []string{"default_value"},
+	})
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return newAccountType(), nil
+	}
+
+	for _, method := range []string{"/account.AccountAPI/GetAccount", "/messaging.Messaging/Send"} {
+		_, err := unary[0](context.Background(), newAccountType(), &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries, want request and response of the enabled method", len(entries))
+	}
+	for _, entry := range entries {
+		fields := entry.ContextMap()
+		if fields["grpc.method"] != "/account.AccountAPI/GetAccount" {
+			t.Errorf("logged method %v", fields["grpc.method"])
+		}
+		if content := fields["grpc.content"].(string); strings.Contains(content, "hunter2") {
+			t.Errorf("logged payload %s contains a redacted value", content)
+		}
+	}
+}
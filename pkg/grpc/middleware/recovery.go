@@ -3,24 +3,74 @@ package middleware
 import (
 	"context"
 	"fmt"
-	"github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/gidyon/micros/pkg/requestid"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"runtime/debug"
 )
 
-func customFunc(ctx context.Context, p interface{}) error {
-	return fmt.Errorf("recovering from panic: %v", p)
+// PanicHook is called with every recovered panic, e.g. to increment a counter or report the error.
+// method is the full gRPC method name and stack the stack trace of the panicking goroutine
+type PanicHook func(ctx context.Context, method string, p interface{}, stack []byte)
+
+// RecoveredMessage is the message returned to clients whose call panicked. The panic value is not
+// returned since it may leak internal details
+const RecoveredMessage = "internal server error"
+
+type recovery struct {
+	logger logging.Logger
+	hooks  []PanicHook
+}
+
+// recover logs the panic p and calls the hooks. It returns the error sent to the client
+func (rec *recovery) recover(ctx context.Context, method string, p interface{}) error {
+	stack := debug.Stack()
+
+	kvs := []interface{}{"grpc.method", method, "panic", fmt.Sprint(p), "stack", string(stack)}
+	if id, ok := requestid.FromContext(ctx); ok {
+		kvs = append(kvs, requestIDTag, id)
+	}
+	rec.logger.Error("recovered from panic", kvs...)
+
+	for _, hook := range rec.hooks {
+		hook(ctx, method, p, stack)
+	}
+
+	return status.Error(codes.Internal, RecoveredMessage)
 }
 
-// AddRecovery recovers from gRPC panics from handlers
-func AddRecovery() ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
-	// Shared option for the logger, with a custom gRPC code to log level function.
-	opt := grpc_recovery.WithRecoveryHandlerContext(customFunc)
+// AddRecovery recovers from panics in gRPC handlers. The panic is logged with its stack trace and
+// the request id, hooks are called and the client gets a codes.Internal error
+func AddRecovery(
+	logger logging.Logger, hooks ...PanicHook,
+) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
+	rec := &recovery{logger: logging.OrNop(logger), hooks: hooks}
 
 	// Recovery handlers should typically be last in the chain so that other middleware
 	// (e.g. logging) can operate on the recovered state instead of being directly affected by any panic
 	return []grpc.UnaryServerInterceptor{
-			grpc_recovery.UnaryServerInterceptor(opt),
-		}, []grpc.StreamServerInterceptor{
-			grpc_recovery.StreamServerInterceptor(opt),
-		}
+		func(
+			ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+		) (_ interface{}, err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = rec.recover(ctx, info.FullMethod, p)
+				}
+			}()
+			return handler(ctx, req)
+		},
+	}, []grpc.StreamServerInterceptor{
+		func(
+			srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+		) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = rec.recover(ss.Context(), info.FullMethod, p)
+				}
+			}()
+			return handler(srv, ss)
+		},
+	}
 }
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/gidyon/micros/pkg/requestid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"testing"
+)
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *fakeServerStream) Context() context.Context {
+	return ss.ctx
+}
+
+func TestRecovery(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	var hooked []string
+	hook := func(ctx context.Context, method string, p interface{}, stack []byte) {
+		if len(stack) == 0 {
+			t.Errorf("hook got no stack")
+		}
+		hooked = append(hooked, method)
+	}
+
+	unary, stream := AddRecovery(logging.NewZap(zap.New(core)), hook)
+
+	ctx := requestid.NewContext(context.Background(), "req-1")
+
+	_, err := unary[0](ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/account.Account/Get"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("secret connection string")
+		})
+	if status.Code(err) != codes.Internal || status.Convert(err).Message() != RecoveredMessage {
+		t.Errorf("unary error = %v, want codes.Internal with %q", err, RecoveredMessage)
+	}
+
+	err = stream[0](nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/account.Account/List"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			var m map[string]int
+			m["boom"]++
+			return nil
+		})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("stream error = %v, want codes.Internal", err)
+	}
+
+	if len(hooked) != 2 || hooked[0] != "/account.Account/Get" || hooked[1] != "/account.Account/List" {
+		t.Errorf("hooks called with %v", hooked)
+	}
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries, want 2", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["panic"] != "secret connection string" || fields[requestIDTag] != "req-1" ||
+		!strings.Contains(fields["stack"].(string), "TestRecovery") {
+		t.Errorf("unexpected log fields %v", fields)
+	}
+}
+
+func TestRecoveryPassesThrough(t *testing.T) {
+	unary, _ := AddRecovery(nil)
+
+	resp, err := unary[0](context.Background(), "req", &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return req, status.Error(codes.NotFound, "missing")
+		})
+	if resp != "req" || status.Code(err) != codes.NotFound {
+		t.Errorf("got %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validatorAll is implemented by messages generated with protoc-gen-validate >= 0.6
+type validatorAll interface {
+	ValidateAll() error
+}
+
+// validator is implemented by messages generated with protoc-gen-validate or hand-written validators
+type validator interface {
+	Validate() error
+}
+
+// fieldError is implemented by errors returned by protoc-gen-validate validators
+type fieldError interface {
+	Field() string
+	Reason() string
+	Cause() error
+}
+
+// multiError is implemented by errors returned by protoc-gen-validate ValidateAll
+type multiError interface {
+	AllErrors() []error
+}
+
+// AddValidation validates request messages implementing ValidateAll() error or Validate() error before
+// calling the handler. ValidateAll is preferred since it reports every violation. Violations are returned as
+// codes.InvalidArgument with errdetails.BadRequest field violations, which the gateway renders as 400.
+// Validators returning a gRPC status have it returned as is
+func AddValidation() ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor) {
+	return []grpc.UnaryServerInterceptor{
+		func(
+			ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+		) (interface{}, error) {
+			if err := validate(req); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		},
+	}, []grpc.StreamServerInterceptor{
+		func(
+			srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+		) error {
+			return handler(srv, &validatingServerStream{ServerStream: ss})
+		},
+	}
+}
+
+// validatingServerStream validates every message received from the client
+type validatingServerStream struct {
+	grpc.ServerStream
+}
+
+func (ss *validatingServerStream) RecvMsg(m interface{}) error {
+	if err := ss.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validate(m)
+}
+
+// validate validates req when it implements a validator and converts violations to a gRPC status error
+func validate(req interface{}) error {
+	var err error
+	switch v := req.(type) {
+	case validatorAll:
+		err = v.ValidateAll()
+	case validator:
+		err = v.Validate()
+	}
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	st, detailsErr := status.New(codes.InvalidArgument, err.Error()).WithDetails(&errdetails.BadRequest{
+		FieldViolations: fieldViolations("", err),
+	})
+	if detailsErr != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return st.Err()
+}
+
+// fieldViolations flattens err into field violations. Nested field names are joined with dots
+func fieldViolations(prefix string, err error) []*errdetails.BadRequest_FieldViolation {
+	switch e := err.(type) {
+	case multiError:
+		violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(e.AllErrors()))
+		for _, err := range e.AllErrors() {
+			violations = append(violations, fieldViolations(prefix, err)...)
+		}
+		return violations
+	case fieldError:
+		field := e.Field()
+		if prefix != "" {
+			field = prefix + "." + field
+		}
+		if cause := e.Cause(); cause != nil {
+			if _, ok := cause.(fieldError); ok {
+				return fieldViolations(field, cause)
+			}
+			if _, ok := cause.(multiError); ok {
+				return fieldViolations(field, cause)
+			}
+		}
+		return []*errdetails.BadRequest_FieldViolation{{Field: field, Description: e.Reason()}}
+	default:
+		return []*errdetails.BadRequest_FieldViolation{{Field: prefix, Description: err.Error()}}
+	}
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fieldValidationError mimics the errors generated by protoc-gen-validate
+type fieldValidationError struct {
+	field  string
+	reason string
+	cause  error
+}
+
+func (e fieldValidationError) Field() string  { return e.field }
+func (e fieldValidationError) Reason() string { return e.reason }
+func (e fieldValidationError) Cause() error   { return e.cause }
+func (e fieldValidationError) Error() string  { return "invalid " + e.field + ": " + e.reason }
+
+type multiValidationError []error
+
+func (m multiValidationError) AllErrors() []error { return m }
+func (m multiValidationError) Error() string {
+	msgs := make([]string, 0, len(m))
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type validateAllRequest struct{ err error }
+
+func (r *validateAllRequest) ValidateAll() error { return r.err }
+func (r *validateAllRequest) Validate() error    { return errors.New("ValidateAll must be preferred") }
+
+type validateRequest struct{ err error }
+
+func (r *validateRequest) Validate() error { return r.err }
+
+type violation struct{ field, description string }
+
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        interface{}
+		code       codes.Code
+		violations []violation
+	}{
+		{name: "no validator", req: "plain", code: codes.OK},
+		{name: "valid", req: &validateRequest{}, code: codes.OK},
+		{
+			name: "single field",
+			req:  &validateRequest{err: fieldValidationError{field: "Email", reason: "value must be a valid email address"}},
+			code: codes.InvalidArgument,
+			violations: []violation{
+				{"Email", "value must be a valid email address"},
+			},
+		},
+		{
+			name: "all violations and nested messages",
+			req: &validateAllRequest{err: multiValidationError{
+				fieldValidationError{field: "Email", reason: "value is required"},
+				fieldValidationError{
+					field: "Address", reason: "embedded message failed validation",
+					cause: multiValidationError{
+						fieldValidationError{field: "City", reason: "value length must be at least 1 runes"},
+						fieldValidationError{field: "Zip", reason: "value does not match regex pattern"},
+					},
+				},
+			}},
+			code: codes.InvalidArgument,
+			violations: []violation{
+				{"Email", "value is required"},
+				{"Address.City", "value length must be at least 1 runes"},
+				{"Address.Zip", "value does not match regex pattern"},
+			},
+		},
+		{
+			name:       "plain error",
+			req:        &validateRequest{err: errors.New("start must be before end")},
+			code:       codes.InvalidArgument,
+			violations: []violation{{"", "start must be before end"}},
+		},
+		{
+			name: "status error",
+			req:  &validateRequest{err: status.Error(codes.FailedPrecondition, "account locked")},
+			code: codes.FailedPrecondition,
+		},
+	}
+
+	unary, _ := AddValidation()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			_, err := unary[0](context.Background(), tt.req, &grpc.UnaryServerInfo{},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					called = true
+					return nil, nil
+				})
+			if status.Code(err) != tt.code {
+				t.Fatalf("code = %s, want %s", status.Code(err), tt.code)
+			}
+			if called != (tt.code == codes.OK) {
+				t.Errorf("handler called = %v", called)
+			}
+
+			var got []violation
+			for _, detail := range status.Convert(err).Details() {
+				for _, v := range detail.(*errdetails.BadRequest).GetFieldViolations() {
+					got = append(got, violation{v.Field, v.Description})
+				}
+			}
+			if !reflect.DeepEqual(got, tt.violations) {
+				t.Errorf("violations = %v, want %v", got, tt.violations)
+			}
+		})
+	}
+}
+
+type recvServerStream struct {
+	grpc.ServerStream
+}
+
+func (ss *recvServerStream) RecvMsg(m interface{}) error {
+	m.(*validateRequest).err = fieldValidationError{field: "Amount", reason: "value must be greater than 0"}
+	return nil
+}
+
+func TestStreamValidation(t *testing.T) {
+	_, stream := AddValidation()
+
+	err := stream[0](nil, &recvServerStream{}, &grpc.StreamServerInfo{},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			return ss.RecvMsg(&validateRequest{})
+		})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("code = %s, want InvalidArgument", status.Code(err))
+	}
+}
@@ -0,0 +1,304 @@
+package http
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/gidyon/micros/pkg/requestid"
+	"github.com/pkg/errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// AccessLogOptions contains options for the access log middleware
+type AccessLogOptions struct {
+	// TrustedProxies are the IPs or CIDRs of proxies whose X-Forwarded-For and X-Real-IP headers are trusted
+	TrustedProxies []string `json:"trustedProxies" yaml:"trustedProxies"`
+	// ExcludePaths are paths that are not logged e.g health probes. A trailing * matches any suffix
+	ExcludePaths []string `json:"excludePaths" yaml:"excludePaths"`
+	// RedactQueryParams are query parameters whose values are replaced in the log;
+	// defaults to DefaultRedactedQueryParams
+	RedactQueryParams []string `json:"redactQueryParams" yaml:"redactQueryParams"`
+	// SampleRate is the fraction of successful requests that are logged; 0 logs all requests.
+	// Requests that fail with a 5xx status are always logged
+	SampleRate float64 `json:"sampleRate" yaml:"sampleRate"`
+}
+
+// DefaultRedactedQueryParams are query parameters redacted when none are configured
+var DefaultRedactedQueryParams = []string{
+	"access_token", "api_key", "apikey", "code", "key", "password", "secret", "token",
+}
+
+const redacted = "REDACTED"
+
+type accessLog struct {
+	logger       logging.Logger
+	proxies      []*net.IPNet
+	exactExclude map[string]struct{}
+	prefixes     []string
+	redact       map[string]struct{}
+	sampleRate   float64
+}
+
+// AccessLog creates a middleware that logs a line for every request with its method, path template, status,
+// response size, latency, request id, client IP and user agent. The path template is the value set with
+// SetPathTemplate or the path with id segments replaced by {id}
+func AccessLog(logger logging.Logger, opt *AccessLogOptions) (Middleware, error) {
+	al, err := newAccessLog(logger, opt)
+	if err != nil {
+		return nil, err
+	}
+	return al.handler, nil
+}
+
+func newAccessLog(logger logging.Logger, opt *AccessLogOptions) (*accessLog, error) {
+	if logger == nil {
+		return nil, errors.New("nil logger")
+	}
+	if opt == nil {
+		opt = &AccessLogOptions{}
+	}
+	if opt.SampleRate < 0 || opt.SampleRate > 1 {
+		return nil, errors.Errorf("sample rate %v is not between 0 and 1", opt.SampleRate)
+	}
+
+	al := &accessLog{
+		logger:       logger,
+		exactExclude: make(map[string]struct{}),
+		redact:       make(map[string]struct{}),
+		sampleRate:   opt.SampleRate,
+	}
+
+	for _, proxy := range opt.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy %q", proxy)
+		}
+		al.proxies = append(al.proxies, ipNet)
+	}
+
+	for _, path := range opt.ExcludePaths {
+		if strings.HasSuffix(path, "*") {
+			al.prefixes = append(al.prefixes, strings.TrimSuffix(path, "*"))
+		} else {
+			al.exactExclude[path] = struct{}{}
+		}
+	}
+
+	redactParams := opt.RedactQueryParams
+	if len(redactParams) == 0 {
+		redactParams = DefaultRedactedQueryParams
+	}
+	for _, param := range redactParams {
+		al.redact[strings.ToLower(param)] = struct{}{}
+	}
+
+	return al, nil
+}
+
+type pathTemplateKey struct{}
+
+// SetPathTemplate sets the route template e.g /api/accounts/{id} logged for the request with ctx.
+// It only has an effect on requests passing through the access log middleware
+func SetPathTemplate(ctx context.Context, template string) {
+	if holder, ok := ctx.Value(pathTemplateKey{}).(*string); ok {
+		*holder = template
+	}
+}
+
+func (al *accessLog) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if al.excluded(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		template := new(string)
+		r = r.WithContext(context.WithValue(r.Context(), pathTemplateKey{}, template))
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		latency := time.Since(start)
+
+		if rec.status < http.StatusInternalServerError && al.sampleRate > 0 && rand.Float64() >= al.sampleRate {
+			return
+		}
+
+		path := *template
+		if path == "" {
+			path = templatePath(r.URL.Path)
+		}
+
+		fields := []interface{}{
+			"http.method", r.Method,
+			"http.path", path,
+			"http.status", rec.status,
+			"http.bytes", rec.bytes,
+			"http.latency", latency,
+			"http.remote_ip", al.remoteIP(r),
+			"http.user_agent", r.UserAgent(),
+		}
+		if r.URL.RawQuery != "" {
+			fields = append(fields, "http.query", al.redactQuery(r.URL.RawQuery))
+		}
+		if id := responseRequestID(r, rec); id != "" {
+			fields = append(fields, "request.id", id)
+		}
+
+		switch {
+		case rec.status >= http.StatusInternalServerError:
+			al.logger.Error("http request", fields...)
+		case rec.status >= http.StatusBadRequest:
+			al.logger.Warn("http request", fields...)
+		default:
+			al.logger.Info("http request", fields...)
+		}
+	})
+}
+
+func (al *accessLog) excluded(path string) bool {
+	if _, ok := al.exactExclude[path]; ok {
+		return true
+	}
+	for _, prefix := range al.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (al *accessLog) trusted(ip net.IP) bool {
+	for _, proxy := range al.proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the client IP. Forwarding headers are only used when the request comes from a
+// trusted proxy; X-Forwarded-For is read from the right skipping trusted proxies
+func (al *accessLog) remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !al.trusted(ip) {
+		return host
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			hopIP := net.ParseIP(hop)
+			if hopIP == nil {
+				break
+			}
+			if !al.trusted(hopIP) || i == 0 {
+				return hop
+			}
+		}
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP.String()
+	}
+
+	return host
+}
+
+func (al *accessLog) redactQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return redacted
+	}
+	for key := range values {
+		if _, ok := al.redact[strings.ToLower(key)]; ok {
+			for i := range values[key] {
+				values[key][i] = redacted
+			}
+		}
+	}
+	return values.Encode()
+}
+
+// idSegment matches path segments that are numbers, UUIDs or long hex strings
+var idSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{24,})$`)
+
+// templatePath replaces id segments of path with {id} so that logged paths have low cardinality
+func templatePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if idSegment.MatchString(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// responseRequestID returns the request id set by the request id middleware or the gateway
+func responseRequestID(r *http.Request, rec *responseRecorder) string {
+	if id, ok := requestid.FromContext(r.Context()); ok {
+		return id
+	}
+	if id := rec.Header().Get(requestid.HeaderKey); id != "" {
+		return id
+	}
+	if id := rec.Header().Get("Grpc-Metadata-" + requestid.HeaderKey); id != "" {
+		return id
+	}
+	return r.Header.Get(requestid.HeaderKey)
+}
+
+// responseRecorder records the status and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(data []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(data)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming gateway responses through
+func (rec *responseRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
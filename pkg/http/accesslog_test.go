@@ -0,0 +1,164 @@
+package http
+
+import (
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/gidyon/micros/pkg/requestid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func observedAccessLog(t *testing.T, opt *AccessLogOptions, h http.Handler) (http.Handler, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	mw, err := AccessLog(logging.NewZap(zap.New(core)), opt)
+	if err != nil {
+		t.Fatalf("AccessLog() error = %v", err)
+	}
+	return mw(h), logs
+}
+
+func TestAccessLog(t *testing.T) {
+	h, logs := observedAccessLog(t, &AccessLogOptions{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(requestid.HeaderKey, "abc-123")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/accounts/42/messages?token=secret&page=2", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if logs.Len() != 1 {
+		t.Fatalf("got %d log lines, want 1", logs.Len())
+	}
+
+	fields := logs.All()[0].ContextMap()
+	want := map[string]interface{}{
+		"http.method":     "POST",
+		"http.path":       "/api/accounts/{id}/messages",
+		"http.status":     int64(http.StatusCreated),
+		"http.bytes":      int64(7),
+		"http.remote_ip":  "192.0.2.1",
+		"http.user_agent": "test-agent",
+		"http.query":      "page=2&token=REDACTED",
+		"request.id":      "abc-123",
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("field %s = %v, want %v", key, fields[key], value)
+		}
+	}
+	if _, ok := fields["http.latency"]; !ok {
+		t.Errorf("latency not logged")
+	}
+}
+
+func TestAccessLogLevelsAndExclusions(t *testing.T) {
+	status := http.StatusOK
+	h, logs := observedAccessLog(t, &AccessLogOptions{ExcludePaths: []string{"/healthz", "/debug/*"}},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}),
+	)
+
+	for _, path := range []string{"/healthz", "/debug/pprof/heap"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if logs.Len() != 0 {
+		t.Errorf("excluded paths were logged")
+	}
+
+	tests := []struct {
+		status int
+		level  zapcore.Level
+	}{
+		{status: http.StatusOK, level: zapcore.InfoLevel},
+		{status: http.StatusNotFound, level: zapcore.WarnLevel},
+		{status: http.StatusBadGateway, level: zapcore.ErrorLevel},
+	}
+	for _, tt := range tests {
+		status = tt.status
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+		entries := logs.TakeAll()
+		if len(entries) != 1 || entries[0].Level != tt.level {
+			t.Errorf("status %d: got %v, want one %s entry", tt.status, entries, tt.level)
+		}
+	}
+}
+
+func TestAccessLogPathTemplate(t *testing.T) {
+	h, logs := observedAccessLog(t, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetPathTemplate(r.Context(), "/api/accounts/{account_id}")
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/accounts/jane", nil))
+
+	if got := logs.All()[0].ContextMap()["http.path"]; got != "/api/accounts/{account_id}" {
+		t.Errorf("http.path = %v, want the template set by the handler", got)
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	status := http.StatusOK
+	h, logs := observedAccessLog(t, &AccessLogOptions{SampleRate: 0.000001},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}),
+	)
+
+	for i := 0; i < 100; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+	}
+	if logs.Len() > 1 {
+		t.Errorf("got %d sampled log lines, want at most 1", logs.Len())
+	}
+
+	status = http.StatusInternalServerError
+	logs.TakeAll()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+	if logs.Len() != 1 {
+		t.Errorf("server errors must always be logged")
+	}
+
+	if _, err := AccessLog(logging.Nop(), &AccessLogOptions{SampleRate: 2}); err == nil {
+		t.Errorf("AccessLog() expected error for sample rate above 1")
+	}
+}
+
+func TestAccessLogRemoteIP(t *testing.T) {
+	al, err := newAccessLog(logging.Nop(), &AccessLogOptions{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}})
+	if err != nil {
+		t.Fatalf("newAccessLog() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{name: "untrusted peer", remoteAddr: "203.0.113.9:1234", forwarded: "198.51.100.1", want: "203.0.113.9"},
+		{name: "trusted peer", remoteAddr: "192.0.2.1:1234", forwarded: "198.51.100.1", want: "198.51.100.1"},
+		{name: "proxy chain", remoteAddr: "10.0.0.2:1234", forwarded: "6.6.6.6, 198.51.100.1, 10.0.0.3", want: "198.51.100.1"},
+		{name: "real ip", remoteAddr: "10.0.0.2:1234", realIP: "198.51.100.7", want: "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := al.remoteIP(r); got != tt.want {
+				t.Errorf("remoteIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,24 +1,244 @@
 package http
 
 import (
+	"github.com/pkg/errors"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-// SupportCORS updates the CORs header for preflight requests
+// CORSOptions contains options for cross-origin resource sharing. Origins that are not allowed
+// get no CORS headers and their preflight requests are rejected
+type CORSOptions struct {
+	// AllowedOrigins are exact origins e.g https://app.example.com, wildcard subdomains e.g
+	// https://*.example.com or * to allow any origin
+	AllowedOrigins []string `json:"allowedOrigins" yaml:"allowedOrigins"`
+	// AllowedOriginPatterns are regular expressions matched against the whole origin
+	AllowedOriginPatterns []string `json:"allowedOriginPatterns" yaml:"allowedOriginPatterns"`
+	// AllowedMethods defaults to GET, POST, PUT, PATCH, DELETE and HEAD
+	AllowedMethods []string `json:"allowedMethods" yaml:"allowedMethods"`
+	// AllowedHeaders defaults to Authorization, Content-Type and Mode; * allows any header
+	AllowedHeaders []string `json:"allowedHeaders" yaml:"allowedHeaders"`
+	// ExposedHeaders are response headers that browsers let clients read
+	ExposedHeaders []string `json:"exposedHeaders" yaml:"exposedHeaders"`
+	// MaxAge is how long in seconds preflight responses may be cached
+	MaxAge int `json:"maxAge" yaml:"maxAge"`
+	// AllowCredentials lets browsers send cookies and authorization headers
+	AllowCredentials bool `json:"allowCredentials" yaml:"allowCredentials"`
+	// GRPCWeb allows and exposes the headers used by grpc-web clients
+	GRPCWeb bool `json:"grpcWeb" yaml:"grpcWeb"`
+}
+
+var (
+	defaultCORSMethods = []string{
+		http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead,
+	}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "Mode"}
+
+	// GRPCWebAllowedHeaders are request headers sent by grpc-web clients
+	GRPCWebAllowedHeaders = []string{"X-Grpc-Web", "X-User-Agent", "Grpc-Timeout", "Content-Type"}
+	// GRPCWebExposedHeaders are response headers read by grpc-web clients
+	GRPCWebExposedHeaders = []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"}
+)
+
+type cors struct {
+	anyOrigin        bool
+	origins          map[string]struct{}
+	wildcards        [][2]string // prefix and suffix around the *
+	patterns         []*regexp.Regexp
+	methods          []string
+	anyHeader        bool
+	headers          map[string]struct{}
+	allowHeaders     string
+	allowMethods     string
+	exposeHeaders    string
+	maxAge           string
+	allowCredentials bool
+}
+
+// CORS creates a middleware that handles CORS preflight and actual requests according to opt
+func CORS(opt *CORSOptions) (Middleware, error) {
+	if opt == nil {
+		return nil, errors.New("nil CORS options")
+	}
+
+	c := &cors{
+		origins:          make(map[string]struct{}),
+		headers:          make(map[string]struct{}),
+		allowCredentials: opt.AllowCredentials,
+	}
+
+	for _, origin := range opt.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			i := strings.Index(origin, "*")
+			c.wildcards = append(c.wildcards, [2]string{origin[:i], origin[i+1:]})
+		case origin != "":
+			c.origins[origin] = struct{}{}
+		}
+	}
+
+	for _, pattern := range opt.AllowedOriginPatterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid CORS origin pattern %q", pattern)
+		}
+		c.patterns = append(c.patterns, re)
+	}
+
+	methods := opt.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	for _, method := range methods {
+		c.methods = append(c.methods, strings.ToUpper(strings.TrimSpace(method)))
+	}
+	c.allowMethods = strings.Join(c.methods, ", ")
+
+	headers := opt.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	exposed := opt.ExposedHeaders
+	if opt.GRPCWeb {
+		headers = append(append([]string{}, headers...), GRPCWebAllowedHeaders...)
+		exposed = append(append([]string{}, exposed...), GRPCWebExposedHeaders...)
+	}
+	allowHeaders := make([]string, 0, len(headers))
+	for _, header := range headers {
+		if header == "*" {
+			c.anyHeader = true
+			continue
+		}
+		canonical := http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if _, ok := c.headers[canonical]; !ok {
+			c.headers[canonical] = struct{}{}
+			allowHeaders = append(allowHeaders, canonical)
+		}
+	}
+	c.allowHeaders = strings.Join(allowHeaders, ", ")
+	c.exposeHeaders = strings.Join(exposed, ", ")
+
+	if opt.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(opt.MaxAge)
+	}
+
+	return c.handler, nil
+}
+
+// SupportCORS updates the CORs header for preflight requests. Any origin is allowed without credentials.
+//
+// Deprecated: Use CORS with an origin allowlist instead
 func SupportCORS(f http.Handler) http.Handler {
+	mw, _ := CORS(&CORSOptions{AllowedOrigins: []string{"*"}})
+	return mw(f)
+}
+
+func (c *cors) originAllowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := c.origins[origin]; ok {
+		return true
+	}
+	for _, wildcard := range c.wildcards {
+		if len(origin) > len(wildcard[0])+len(wildcard[1]) &&
+			strings.HasPrefix(origin, wildcard[0]) && strings.HasSuffix(origin, wildcard[1]) {
+			return true
+		}
+	}
+	for _, pattern := range c.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cors) methodAllowed(method string) bool {
+	method = strings.ToUpper(method)
+	for _, allowed := range c.methods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cors) headersAllowed(requested string) bool {
+	if c.anyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		if _, ok := c.headers[http.CanonicalHeaderKey(header)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cors) setOrigin(w http.ResponseWriter, origin string) {
+	// Credentials are never allowed with a wildcard origin
+	if c.anyOrigin && !c.allowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.allowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Options request
-		if r.Method == http.MethodOptions {
-			w.Header().Set("access-control-allow-origin", "*")
-			w.Header().Set("access-control-allow-methods", "POST, GET, PUT, PATCH, DELETE")
-			w.Header().Set("access-control-allow-headers", "Authorization, Content-Type, Mode")
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// Responses vary by origin so caches must not share them across origins
+		w.Header().Add("Vary", "Origin")
+
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+			if origin == "" || !c.originAllowed(origin) ||
+				!c.methodAllowed(r.Header.Get("Access-Control-Request-Method")) ||
+				!c.headersAllowed(requestedHeaders) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			c.setOrigin(w, origin)
+			w.Header().Set("Access-Control-Allow-Methods", c.allowMethods)
+			if c.anyHeader && requestedHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", requestedHeaders)
+			} else if c.allowHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", c.allowHeaders)
+			}
+			if c.maxAge != "" {
+				w.Header().Set("Access-Control-Max-Age", c.maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
-		// For Preflight request
-		w.Header().Set("access-control-allow-origin", r.Header.Get("origin"))
-		w.Header().Set("access-control-allow-credentials", "true")
-		w.Header().Set("access-control-allow-headers", "Authorization, Content-Type, Mode")
-		f.ServeHTTP(w, r)
+		if origin != "" && c.originAllowed(origin) {
+			c.setOrigin(w, origin)
+			if c.exposeHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", c.exposeHeaders)
+			}
+		}
+
+		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	mw, err := CORS(&CORSOptions{
+		AllowedOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+		AllowedOriginPatterns: []string{`https://pr-[0-9]+\.preview\.dev`},
+		AllowedHeaders:        []string{"Authorization", "Content-Type"},
+		MaxAge:                600,
+		AllowCredentials:      true,
+		GRPCWeb:               true,
+	})
+	if err != nil {
+		t.Fatalf("CORS() error = %v", err)
+	}
+
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		reqMethod  string
+		reqHeaders string
+		wantStatus int
+		wantOrigin string
+	}{
+		{name: "exact origin", method: http.MethodGet, origin: "https://app.example.com", wantStatus: 200, wantOrigin: "https://app.example.com"},
+		{name: "wildcard subdomain", method: http.MethodGet, origin: "https://a.example.org", wantStatus: 200, wantOrigin: "https://a.example.org"},
+		{name: "wildcard needs subdomain", method: http.MethodGet, origin: "https://.example.org", wantStatus: 200},
+		{name: "regex origin", method: http.MethodGet, origin: "https://pr-12.preview.dev", wantStatus: 200, wantOrigin: "https://pr-12.preview.dev"},
+		{name: "unknown origin", method: http.MethodGet, origin: "https://evil.com", wantStatus: 200},
+		{name: "suffix attack", method: http.MethodGet, origin: "https://app.example.com.evil.com", wantStatus: 200},
+		{
+			name: "preflight allowed", method: http.MethodOptions, origin: "https://app.example.com",
+			reqMethod: "POST", reqHeaders: "content-type, x-grpc-web", wantStatus: 204, wantOrigin: "https://app.example.com",
+		},
+		{
+			name: "preflight unknown origin", method: http.MethodOptions, origin: "https://evil.com",
+			reqMethod: "POST", wantStatus: 403,
+		},
+		{
+			name: "preflight header not allowed", method: http.MethodOptions, origin: "https://app.example.com",
+			reqMethod: "POST", reqHeaders: "X-Secret", wantStatus: 403,
+		},
+		{
+			name: "preflight method not allowed", method: http.MethodOptions, origin: "https://app.example.com",
+			reqMethod: "TRACE", wantStatus: 403,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("Origin", tt.origin)
+			if tt.reqMethod != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+			}
+			if tt.reqHeaders != "" {
+				r.Header.Set("Access-Control-Request-Headers", tt.reqHeaders)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("allow origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Vary"); got == "" {
+				t.Errorf("missing Vary header")
+			}
+			if tt.wantOrigin != "" && tt.method != http.MethodOptions {
+				if got := w.Header().Get("Access-Control-Expose-Headers"); got == "" {
+					t.Errorf("missing grpc-web exposed headers")
+				}
+			}
+		})
+	}
+}
+
+func TestSupportCORS(t *testing.T) {
+	h := SupportCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://any.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("allow origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("allow credentials = %q, want none", got)
+	}
+}
@@ -3,32 +3,22 @@ package http
 
 import (
 	"context"
+	"github.com/gidyon/micros/pkg/requestid"
 	"github.com/pkg/errors"
-	"math/rand"
 	"net/http"
-	"time"
 )
 
-type id int
-
-const key = id(12)
-
-// AddRequestID adds request id to handler
+// AddRequestID adds request id to handler. An incoming X-Request-ID header is honoured,
+// otherwise a new id is generated. The id is echoed back in the X-Request-ID response header
 func AddRequestID(h http.Handler) http.Handler {
-	rand.Seed(time.Now().UnixNano())
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		r = r.WithContext(context.WithValue(ctx, key, rand.Int()))
-		h.ServeHTTP(w, r)
-	})
+	return requestid.Handler(h)
 }
 
 // GetRequestID retrieves the request id from context
-func GetRequestID(ctx context.Context) (int, error) {
-	v := ctx.Value(key)
-	vint, ok := v.(id)
+func GetRequestID(ctx context.Context) (string, error) {
+	id, ok := requestid.FromContext(ctx)
 	if !ok {
-		return 0, errors.New("failed to get value from context")
+		return "", errors.New("failed to get value from context")
 	}
-	return int(vint), nil
+	return id, nil
 }
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// MaxBodySize limits request bodies to limit bytes. Requests declaring a larger body are rejected
+// with 413 Request Entity Too Large. Bodies that turn out larger, e.g chunked ones, fail to read past
+// the limit and the response is replaced with 413 unless the handler already wrote its headers
+func MaxBodySize(limit int64) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			body := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit)}
+			r.Body = body
+			lw := &limitWriter{ResponseWriter: w, body: body}
+
+			h.ServeHTTP(lw, r)
+
+			if body.exceeded && !lw.wroteHeader {
+				lw.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+}
+
+// limitedBody records whether reading went past the limit
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		body.exceeded = true
+	}
+	return n, err
+}
+
+// limitWriter replaces the response of handlers that read past the limit with 413
+type limitWriter struct {
+	http.ResponseWriter
+	body        *limitedBody
+	wroteHeader bool
+	rejected    bool
+}
+
+func (lw *limitWriter) WriteHeader(code int) {
+	if lw.wroteHeader {
+		return
+	}
+	lw.wroteHeader = true
+	if lw.body.exceeded {
+		lw.rejected = true
+		http.Error(lw.ResponseWriter, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	lw.ResponseWriter.WriteHeader(code)
+}
+
+func (lw *limitWriter) Write(b []byte) (int, error) {
+	if !lw.wroteHeader {
+		lw.WriteHeader(http.StatusOK)
+	}
+	if lw.rejected {
+		return len(b), nil
+	}
+	return lw.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming gateway responses through
+func (lw *limitWriter) Flush() {
+	if lw.rejected {
+		return
+	}
+	if flusher, ok := lw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (lw *limitWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
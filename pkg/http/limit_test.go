@@ -0,0 +1,52 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	h := MaxBodySize(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+	}))
+
+	// handlers that report read errors themselves are overridden
+	failing := MaxBodySize(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantStatus    int
+	}{
+		{name: "within limit", body: "12345678", contentLength: 8, wantStatus: http.StatusOK},
+		{name: "declared too large", body: "123456789", contentLength: 9, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked too large", body: "123456789", contentLength: -1, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.ContentLength = tt.contentLength
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.ContentLength = tt.contentLength
+			w = httptest.NewRecorder()
+			failing.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status with failing handler = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
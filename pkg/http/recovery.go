@@ -0,0 +1,55 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"github.com/gidyon/micros/pkg/logging"
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicHook is called with every recovered panic, e.g. to increment a counter or report the error.
+// endpoint is the request method and path and stack the stack trace of the panicking goroutine
+type PanicHook func(ctx context.Context, endpoint string, p interface{}, stack []byte)
+
+// Recovery recovers from panics in handlers. The panic is logged with its stack trace and the request id,
+// hooks are called and the client gets 500 Internal Server Error if nothing was written yet.
+// http.ErrAbortHandler is re-panicked so that the server aborts the response as intended
+func Recovery(logger logging.Logger, hooks ...PanicHook) Middleware {
+	logger = logging.OrNop(logger)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &responseRecorder{ResponseWriter: w}
+
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				stack := debug.Stack()
+				endpoint := r.Method + " " + r.URL.Path
+
+				kvs := []interface{}{"http.method", r.Method, "path", r.URL.Path, "panic", fmt.Sprint(p), "stack", string(stack)}
+				if id := responseRequestID(r, rec); id != "" {
+					kvs = append(kvs, "request.id", id)
+				}
+				logger.Error("recovered from panic", kvs...)
+
+				for _, hook := range hooks {
+					hook(r.Context(), endpoint, p, stack)
+				}
+
+				if !rec.wroteHeader {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+
+			h.ServeHTTP(rec, r)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/gidyon/micros/pkg/requestid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	var endpoints []string
+	hook := func(ctx context.Context, endpoint string, p interface{}, stack []byte) {
+		endpoints = append(endpoints, endpoint)
+	}
+	recovery := Recovery(logging.NewZap(zap.New(core)), hook)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{
+			name:    "panic before writing",
+			handler: func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			status:  http.StatusInternalServerError,
+		},
+		{
+			name: "panic after writing",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				panic("boom")
+			},
+			status: http.StatusAccepted,
+		},
+		{
+			name:    "no panic",
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+			status:  http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			requestid.Handler(recovery(tt.handler)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/accounts", nil))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+
+	if len(endpoints) != 2 || endpoints[0] != "GET /accounts" {
+		t.Errorf("hooks called with %v", endpoints)
+	}
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries, want 2", len(entries))
+	}
+	if fields := entries[0].ContextMap(); fields["panic"] != "boom" || fields["request.id"] == nil || fields["stack"] == "" {
+		t.Errorf("unexpected log fields %v", fields)
+	}
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", p)
+		}
+	}()
+	Recovery(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,282 @@
+// Package idempotency makes retried gRPC and gateway calls safe using client supplied idempotency keys.
+//
+// Clients send a unique key in the Idempotency-Key header or idempotency-key metadata. The first call with a key
+// runs the handler and stores its response. Later calls with the same key and request get the stored response,
+// calls made while the first one is running fail with codes.Aborted and calls with a different request fail
+// with codes.InvalidArgument. Calls that fail release the key so that they can be retried.
+//
+// Keys are scoped to the method and the caller so that one client can not replay the response of another.
+// The caller is identified by the authorization metadata unless Options.Principal is set.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gidyon/micros/pkg/errs"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderKey is the HTTP header carrying the idempotency key
+	HeaderKey = "Idempotency-Key"
+	// MetadataKey is the gRPC metadata key carrying the idempotency key
+	MetadataKey = "idempotency-key"
+	// ReplayedMetadataKey is set in the response header metadata of replayed calls
+	ReplayedMetadataKey = "idempotent-replayed"
+
+	defaultTTL   = 24 * time.Hour
+	maxKeyLength = 255
+)
+
+// Record is the state stored for an idempotency key
+type Record struct {
+	// Fingerprint identifies the method and request the key was first used with
+	Fingerprint string `json:"fingerprint"`
+	// Done is false while the first call is running
+	Done bool `json:"done"`
+	// Response is the response of the first call marshaled as google.protobuf.Any
+	Response []byte `json:"response,omitempty"`
+}
+
+// Store persists idempotency records
+type Store interface {
+	// Reserve stores record for key unless key is already stored. It returns true when key was reserved,
+	// otherwise the stored record
+	Reserve(ctx context.Context, key string, record *Record, ttl time.Duration) (*Record, bool, error)
+	// Complete replaces the record of a reserved key
+	Complete(ctx context.Context, key string, record *Record, ttl time.Duration) error
+	// Release deletes the record of key
+	Release(ctx context.Context, key string) error
+}
+
+// Options contains options for idempotent calls
+type Options struct {
+	// Methods are the full gRPC method names covered e.g /account.AccountAPI/CreateAccount.
+	// A trailing * matches any suffix e.g /account.AccountAPI/Create*. All methods are covered when empty
+	Methods []string `json:"methods" yaml:"methods"`
+	// TTL is how long keys and responses are kept. Defaults to 24 hours
+	TTL time.Duration `json:"ttl" yaml:"ttl"`
+	// Store persists the records. The service redis client or SQL database is used when nil
+	Store Store `json:"-" yaml:"-"`
+	// Principal returns the authenticated caller of a call, which keys are scoped to.
+	// AuthorizationPrincipal is used when nil
+	Principal func(ctx context.Context) string `json:"-" yaml:"-"`
+}
+
+type interceptor struct {
+	store     Store
+	principal func(ctx context.Context) string
+	ttl       time.Duration
+	methods   map[string]struct{}
+	prefixes  []string
+}
+
+// UnaryServerInterceptor returns an interceptor making calls to the methods in opt idempotent.
+// Calls without an idempotency key are not affected
+func UnaryServerInterceptor(opt *Options) (grpc.UnaryServerInterceptor, error) {
+	switch {
+	case opt == nil:
+		return nil, errors.New("idempotency options must not be nil")
+	case opt.Store == nil:
+		return nil, errors.New("idempotency store must not be nil")
+	case opt.TTL < 0:
+		return nil, errors.Errorf("idempotency ttl must not be negative: %s", opt.TTL)
+	}
+
+	ic := &interceptor{
+		store:     opt.Store,
+		principal: opt.Principal,
+		ttl:       opt.TTL,
+		methods:   make(map[string]struct{}),
+	}
+	if ic.ttl == 0 {
+		ic.ttl = defaultTTL
+	}
+	if ic.principal == nil {
+		ic.principal = AuthorizationPrincipal
+	}
+
+	for _, method := range opt.Methods {
+		if strings.HasSuffix(method, "*") {
+			ic.prefixes = append(ic.prefixes, strings.TrimSuffix(method, "*"))
+		} else {
+			ic.methods[method] = struct{}{}
+		}
+	}
+
+	return ic.unaryInterceptor, nil
+}
+
+func (ic *interceptor) covers(fullMethod string) bool {
+	if len(ic.methods) == 0 && len(ic.prefixes) == 0 {
+		return true
+	}
+	if _, ok := ic.methods[fullMethod]; ok {
+		return true
+	}
+	for _, prefix := range ic.prefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ic *interceptor) unaryInterceptor(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if !ic.covers(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	key, ok := keyFromIncomingContext(ctx)
+	if !ok {
+		return handler(ctx, req)
+	}
+	if len(key) > maxKeyLength {
+		return nil, errs.Validation("idempotency key is too long", errs.FieldViolation{
+			Field:       MetadataKey,
+			Description: "must not be longer than 255 characters",
+		})
+	}
+
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return handler(ctx, req)
+	}
+	fingerprint, err := requestFingerprint(info.FullMethod, msg)
+	if err != nil {
+		return nil, errs.Internal(err, "failed to fingerprint request")
+	}
+
+	// keys are scoped to the method and the caller; the principal is hashed so that no credentials are stored
+	principal := sha256.Sum256([]byte(ic.principal(ctx)))
+	key = info.FullMethod + ":" + hex.EncodeToString(principal[:]) + ":" + key
+
+	stored, reserved, err := ic.store.Reserve(ctx, key, &Record{Fingerprint: fingerprint}, ic.ttl)
+	if err != nil {
+		return nil, errs.Wrap(err, errs.KindUnavailable, "failed to reserve idempotency key")
+	}
+	if !reserved {
+		return replay(ctx, stored, fingerprint)
+	}
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		ic.release(key)
+		return nil, err
+	}
+
+	record, err := completedRecord(fingerprint, resp)
+	if err == nil {
+		err = ic.store.Complete(ctx, key, record, ic.ttl)
+	}
+	if err != nil {
+		// the call succeeded; the key is released so that a retry is not rejected until the ttl expires
+		ic.release(key)
+	}
+
+	return resp, nil
+}
+
+// release deletes key even when the call context was cancelled
+func (ic *interceptor) release(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ic.store.Release(ctx, key)
+}
+
+// replay returns the response stored in record
+func replay(ctx context.Context, record *Record, fingerprint string) (interface{}, error) {
+	switch {
+	case record.Fingerprint != fingerprint:
+		return nil, errs.Validation("idempotency key was used with a different request", errs.FieldViolation{
+			Field:       MetadataKey,
+			Description: "must be unique for each request",
+		})
+	case !record.Done:
+		return nil, errs.Conflict("a request with the same idempotency key is in progress")
+	}
+
+	stored := &anypb.Any{}
+	if err := protov2.Unmarshal(record.Response, stored); err != nil {
+		return nil, errs.Internal(err, "failed to decode stored response")
+	}
+	resp, err := stored.UnmarshalNew()
+	if err != nil {
+		return nil, errs.Internal(err, "failed to decode stored response")
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(ReplayedMetadataKey, "true"))
+
+	return resp, nil
+}
+
+// completedRecord creates the record stored for a successful call
+func completedRecord(fingerprint string, resp interface{}) (*Record, error) {
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("response %T is not a protobuf message", resp)
+	}
+	wrapped, err := anypb.New(proto.MessageV2(msg))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to wrap response")
+	}
+	data, err := protov2.Marshal(wrapped)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+	return &Record{Fingerprint: fingerprint, Done: true, Response: data}, nil
+}
+
+// requestFingerprint hashes the method and the deterministic encoding of req
+func requestFingerprint(fullMethod string, req proto.Message) (string, error) {
+	data, err := protov2.MarshalOptions{Deterministic: true}.Marshal(proto.MessageV2(req))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal request")
+	}
+	hash := sha256.New()
+	hash.Write([]byte(fullMethod))
+	hash.Write([]byte{0})
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// keyFromIncomingContext returns the idempotency key in the incoming gRPC metadata of ctx
+func keyFromIncomingContext(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	keys := md.Get(MetadataKey)
+	if len(keys) == 0 || keys[0] == "" {
+		return "", false
+	}
+	return keys[0], true
+}
+
+// AuthorizationPrincipal identifies the caller by the authorization metadata of the call, which the gateway
+// sets from the Authorization header. Calls without credentials share the empty principal
+func AuthorizationPrincipal(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return strings.Join(md.Get("authorization"), "\n")
+}
+
+// GatewayMetadata forwards the Idempotency-Key header of a gateway request as gRPC metadata.
+// It is used with runtime.WithMetadata
+func GatewayMetadata(ctx context.Context, r *http.Request) metadata.MD {
+	key := r.Header.Get(HeaderKey)
+	if key == "" {
+		return nil
+	}
+	return metadata.Pairs(MetadataKey, key)
+}
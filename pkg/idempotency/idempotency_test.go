@@ -0,0 +1,162 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const createMethod = "/account.AccountAPI/CreateAccount"
+
+func newTestInterceptor(t *testing.T, methods ...string) (grpc.UnaryServerInterceptor, *RedisStore) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "")
+	interceptor, err := UnaryServerInterceptor(&Options{Methods: methods, TTL: time.Minute, Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return interceptor, store
+}
+
+func withKey(key string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, key))
+}
+
+type countingHandler struct {
+	calls int
+	err   error
+}
+
+func (h *countingHandler) handle(ctx context.Context, req interface{}) (interface{}, error) {
+	h.calls++
+	if h.err != nil {
+		return nil, h.err
+	}
+	return wrapperspb.String("account-" + req.(*wrapperspb.StringValue).GetValue()), nil
+}
+
+func TestReplay(t *testing.T) {
+	interceptor, _ := newTestInterceptor(t, "/account.AccountAPI/Create*")
+	handler := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: createMethod}
+
+	for i := 0; i < 2; i++ {
+		resp, err := interceptor(withKey("key-1"), wrapperspb.String("alice"), info, handler.handle)
+		if err != nil {
+			t.Fatalf("call %d failed: %v", i, err)
+		}
+		if got := resp.(*wrapperspb.StringValue).GetValue(); got != "account-alice" {
+			t.Errorf("call %d got %q", i, got)
+		}
+	}
+	if handler.calls != 1 {
+		t.Errorf("handler called %d times, want 1", handler.calls)
+	}
+
+	_, err := interceptor(withKey("key-1"), wrapperspb.String("bob"), info, handler.handle)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("reusing a key for another request: code = %s, want InvalidArgument", status.Code(err))
+	}
+
+	// keys are scoped to the method and calls without a key are not affected
+	interceptor(withKey("key-1"), wrapperspb.String("alice"), &grpc.UnaryServerInfo{FullMethod: "/account.AccountAPI/CreateAdmin"}, handler.handle)
+	interceptor(context.Background(), wrapperspb.String("alice"), info, handler.handle)
+	interceptor(withKey("key-1"), wrapperspb.String("alice"), &grpc.UnaryServerInfo{FullMethod: "/account.AccountAPI/GetAccount"}, handler.handle)
+	interceptor(withKey("key-1"), wrapperspb.String("alice"), &grpc.UnaryServerInfo{FullMethod: "/account.AccountAPI/GetAccount"}, handler.handle)
+	if handler.calls != 5 {
+		t.Errorf("handler called %d times, want 5", handler.calls)
+	}
+}
+
+func TestConcurrentDuplicate(t *testing.T) {
+	interceptor, _ := newTestInterceptor(t)
+	info := &grpc.UnaryServerInfo{FullMethod: createMethod}
+
+	var inner error
+	_, err := interceptor(withKey("key-1"), wrapperspb.String("alice"), info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			_, inner = interceptor(withKey("key-1"), wrapperspb.String("alice"), info, (&countingHandler{}).handle)
+			return wrapperspb.String("created"), nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Code(inner) != codes.Aborted {
+		t.Errorf("duplicate in progress: code = %s, want Aborted", status.Code(inner))
+	}
+}
+
+func TestFailedCallReleasesKey(t *testing.T) {
+	interceptor, _ := newTestInterceptor(t)
+	info := &grpc.UnaryServerInfo{FullMethod: createMethod}
+	handler := &countingHandler{err: status.Error(codes.Unavailable, "database down")}
+
+	if _, err := interceptor(withKey("key-1"), wrapperspb.String("alice"), info, handler.handle); status.Code(err) != codes.Unavailable {
+		t.Fatalf("code = %s, want Unavailable", status.Code(err))
+	}
+
+	handler.err = nil
+	if _, err := interceptor(withKey("key-1"), wrapperspb.String("alice"), info, handler.handle); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if handler.calls != 2 {
+		t.Errorf("handler called %d times, want 2", handler.calls)
+	}
+
+	_, err := interceptor(withKey(strings.Repeat("k", maxKeyLength+1)), wrapperspb.String("alice"), info, handler.handle)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("long key: code = %s, want InvalidArgument", status.Code(err))
+	}
+}
+
+func TestKeysScopedToPrincipal(t *testing.T) {
+	interceptor, _ := newTestInterceptor(t)
+	handler := &countingHandler{}
+	info := &grpc.UnaryServerInfo{FullMethod: createMethod}
+
+	withCaller := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "key-1", "authorization", token))
+	}
+
+	for _, ctx := range []context.Context{withCaller("Bearer alice"), withCaller("Bearer bob"), withCaller("Bearer alice")} {
+		if _, err := interceptor(ctx, wrapperspb.String("alice"), info, handler.handle); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if handler.calls != 2 {
+		t.Errorf("handler called %d times, want one call for each principal", handler.calls)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for _, opt := range []*Options{nil, {}, {Store: &RedisStore{}, TTL: -time.Second}} {
+		if _, err := UnaryServerInterceptor(opt); err == nil {
+			t.Errorf("expected an error for %+v", opt)
+		}
+	}
+}
+
+func TestGatewayMetadata(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/accounts", nil)
+	if md := GatewayMetadata(context.Background(), r); md != nil {
+		t.Errorf("got %v for a request without a key", md)
+	}
+	r.Header.Set(HeaderKey, "key-1")
+	if got := GatewayMetadata(context.Background(), r).Get(MetadataKey); len(got) != 1 || got[0] != "key-1" {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,81 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// DefaultRedisPrefix is prepended to the keys stored by RedisStore
+const DefaultRedisPrefix = "idempotency:"
+
+// RedisStore stores records in redis as JSON strings that expire after the ttl
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a store using client. Keys are prefixed with DefaultRedisPrefix when prefix is empty
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Reserve stores record for key with SETNX unless key is already stored
+func (store *RedisStore) Reserve(
+	ctx context.Context, key string, record *Record, ttl time.Duration,
+) (*Record, bool, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to marshal idempotency record")
+	}
+
+	client := store.client.WithContext(ctx)
+
+	// the stored record may expire between SETNX and GET, in which case the key is reserved again
+	for attempt := 0; attempt < 2; attempt++ {
+		reserved, err := client.SetNX(store.prefix+key, data, ttl).Result()
+		if err != nil {
+			return nil, false, errors.Wrap(err, "failed to reserve idempotency key")
+		}
+		if reserved {
+			return nil, true, nil
+		}
+
+		stored, err := client.Get(store.prefix + key).Bytes()
+		switch {
+		case err == redis.Nil:
+			continue
+		case err != nil:
+			return nil, false, errors.Wrap(err, "failed to get idempotency record")
+		}
+
+		existing := &Record{}
+		if err := json.Unmarshal(stored, existing); err != nil {
+			return nil, false, errors.Wrap(err, "failed to unmarshal idempotency record")
+		}
+		return existing, false, nil
+	}
+
+	return nil, false, errors.Errorf("failed to reserve idempotency key %s", key)
+}
+
+// Complete replaces the record of key
+func (store *RedisStore) Complete(ctx context.Context, key string, record *Record, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal idempotency record")
+	}
+	err = store.client.WithContext(ctx).Set(store.prefix+key, data, ttl).Err()
+	return errors.Wrap(err, "failed to save idempotency record")
+}
+
+// Release deletes the record of key
+func (store *RedisStore) Release(ctx context.Context, key string) error {
+	err := store.client.WithContext(ctx).Del(store.prefix + key).Err()
+	return errors.Wrap(err, "failed to delete idempotency record")
+}
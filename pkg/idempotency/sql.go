@@ -0,0 +1,103 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/gidyon/micros/pkg/errs"
+	"github.com/pkg/errors"
+	"regexp"
+	"time"
+)
+
+// DefaultTable is the table used by SQLStore when no table is given
+const DefaultTable = "idempotency_keys"
+
+var validTable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// SQLStore stores records in a MySQL table. Expired records are replaced when their key is reserved again
+type SQLStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLStore creates a store using the given table of db. DefaultTable is used when table is empty
+func NewSQLStore(db *sql.DB, table string) (*SQLStore, error) {
+	if db == nil {
+		return nil, errors.New("idempotency store db must not be nil")
+	}
+	if table == "" {
+		table = DefaultTable
+	}
+	if !validTable.MatchString(table) {
+		return nil, errors.Errorf("invalid idempotency table name %q", table)
+	}
+	return &SQLStore{db: db, table: table}, nil
+}
+
+// CreateTable creates the table of the store if it does not exist
+func (store *SQLStore) CreateTable(ctx context.Context) error {
+	_, err := store.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	idempotency_key VARCHAR(512) NOT NULL PRIMARY KEY,
+	fingerprint CHAR(64) NOT NULL,
+	done BOOLEAN NOT NULL,
+	response MEDIUMBLOB,
+	expires_at BIGINT NOT NULL
+)`, store.table))
+	return errors.Wrapf(err, "failed to create table %s", store.table)
+}
+
+// Reserve inserts record for key unless key is already stored and not expired
+func (store *SQLStore) Reserve(
+	ctx context.Context, key string, record *Record, ttl time.Duration,
+) (*Record, bool, error) {
+	now := time.Now()
+
+	_, err := store.db.ExecContext(ctx, fmt.Sprintf(
+		"DELETE FROM %s WHERE idempotency_key = ? AND expires_at <= ?", store.table,
+	), key, unixMillis(now))
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to delete expired idempotency record")
+	}
+
+	_, err = store.db.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (idempotency_key, fingerprint, done, response, expires_at) VALUES (?, ?, ?, ?, ?)", store.table,
+	), key, record.Fingerprint, record.Done, record.Response, unixMillis(now.Add(ttl)))
+	switch {
+	case err == nil:
+		return nil, true, nil
+	case !errs.Is(err, errs.KindAlreadyExists):
+		return nil, false, errors.Wrap(err, "failed to reserve idempotency key")
+	}
+
+	existing := &Record{}
+	err = store.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT fingerprint, done, response FROM %s WHERE idempotency_key = ?", store.table,
+	), key).Scan(&existing.Fingerprint, &existing.Done, &existing.Response)
+	switch {
+	case err == sql.ErrNoRows:
+		// released by the call holding the key; reported as in progress so that the client retries
+		return &Record{Fingerprint: record.Fingerprint}, false, nil
+	case err != nil:
+		return nil, false, errors.Wrap(err, "failed to get idempotency record")
+	}
+	return existing, false, nil
+}
+
+// Complete replaces the record of key
+func (store *SQLStore) Complete(ctx context.Context, key string, record *Record, ttl time.Duration) error {
+	_, err := store.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET fingerprint = ?, done = ?, response = ?, expires_at = ? WHERE idempotency_key = ?", store.table,
+	), record.Fingerprint, record.Done, record.Response, unixMillis(time.Now().Add(ttl)), key)
+	return errors.Wrap(err, "failed to save idempotency record")
+}
+
+// Release deletes the record of key
+func (store *SQLStore) Release(ctx context.Context, key string) error {
+	_, err := store.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE idempotency_key = ?", store.table), key)
+	return errors.Wrap(err, "failed to delete idempotency record")
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,57 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSQLStoreReserve(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store, err := NewSQLStore(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleteExpired := regexp.QuoteMeta("DELETE FROM idempotency_keys WHERE idempotency_key = ? AND expires_at <= ?")
+	insert := regexp.QuoteMeta("INSERT INTO idempotency_keys")
+	selectRecord := regexp.QuoteMeta("SELECT fingerprint, done, response FROM idempotency_keys WHERE idempotency_key = ?")
+
+	mock.ExpectExec(deleteExpired).WithArgs("key-1", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, reserved, err := store.Reserve(context.Background(), "key-1", &Record{Fingerprint: "abc"}, time.Minute)
+	if err != nil || !reserved {
+		t.Fatalf("first reserve: reserved = %v, err = %v", reserved, err)
+	}
+
+	mock.ExpectExec(deleteExpired).WithArgs("key-1", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+	mock.ExpectQuery(selectRecord).WithArgs("key-1").WillReturnRows(
+		sqlmock.NewRows([]string{"fingerprint", "done", "response"}).AddRow("abc", true, []byte("resp")),
+	)
+
+	existing, reserved, err := store.Reserve(context.Background(), "key-1", &Record{Fingerprint: "abc"}, time.Minute)
+	if err != nil || reserved {
+		t.Fatalf("second reserve: reserved = %v, err = %v", reserved, err)
+	}
+	if existing.Fingerprint != "abc" || !existing.Done || string(existing.Response) != "resp" {
+		t.Errorf("got record %+v", existing)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := NewSQLStore(db, "keys; DROP TABLE accounts"); err == nil {
+		t.Errorf("expected an error for an invalid table name")
+	}
+}
@@ -0,0 +1,83 @@
+// Package logging defines the Logger used by micros services and packages with adapters for zap,
+// logrus and slog
+package logging
+
+import (
+	"fmt"
+)
+
+// Level is the severity of a log
+type Level int8
+
+// Levels supported by Logger
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (level Level) String() string {
+	switch level {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("Level(%d)", level)
+}
+
+// Logger writes structured logs. keysAndValues are alternating keys and values e.g
+// logger.Info("connected to service", "service", name, "address", address)
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+	// With returns a logger that adds keysAndValues to every log
+	With(keysAndValues ...interface{}) Logger
+	// Enabled reports whether logs at level are written; used to skip building expensive logs
+	Enabled(level Level) bool
+}
+
+type nopLogger struct{}
+
+// Nop returns a logger that discards all logs. It is useful in tests
+func Nop() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+func (l nopLogger) With(...interface{}) Logger { return l }
+func (nopLogger) Enabled(Level) bool           { return false }
+
+// OrNop returns logger or a no-op logger when it is nil
+func OrNop(logger Logger) Logger {
+	if logger == nil {
+		return Nop()
+	}
+	return logger
+}
+
+// fields pairs up keysAndValues. A key without a value gets the value MISSING and keys that are
+// not strings are formatted with %v
+func fields(keysAndValues []interface{}, add func(key string, value interface{})) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", keysAndValues[i])
+		}
+		if i+1 < len(keysAndValues) {
+			add(key, keysAndValues[i+1])
+		} else {
+			add(key, "MISSING")
+		}
+	}
+}
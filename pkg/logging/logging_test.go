@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Sirupsen/logrus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+func TestZap(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := NewZap(zap.New(core)).With("service", "account")
+
+	logger.Debug("not written")
+	logger.Info("connected", "address", "localhost:9090", "attempt", 2)
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if entries[0].Message != "connected" || fields["service"] != "account" ||
+		fields["address"] != "localhost:9090" || fields["attempt"] != int64(2) {
+		t.Errorf("got entry %s %v", entries[0].Message, fields)
+	}
+
+	if logger.Enabled(LevelDebug) || !logger.Enabled(LevelInfo) {
+		t.Errorf("Enabled() does not match the level of the zap core")
+	}
+
+	if zapLogger, ok := Zap(logger); !ok || zapLogger == nil {
+		t.Errorf("Zap() did not return the zap logger")
+	}
+}
+
+func TestLogrus(t *testing.T) {
+	out := &bytes.Buffer{}
+	logrusLogger := logrus.New()
+	logrusLogger.Out = out
+	logrusLogger.Formatter = &logrus.JSONFormatter{}
+	logrusLogger.Level = logrus.WarnLevel
+
+	logger := NewLogrus(logrusLogger).With("service", "account")
+	logger.Info("not written")
+	logger.Warn("slow call", "method", "GetAccount", "odd")
+
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to decode %s: %v", out, err)
+	}
+	want := map[string]interface{}{
+		"msg": "slow call", "level": "warning", "service": "account", "method": "GetAccount", "odd": "MISSING",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+
+	if logger.Enabled(LevelInfo) || !logger.Enabled(LevelError) {
+		t.Errorf("Enabled() does not match the logrus level")
+	}
+}
+
+func TestNop(t *testing.T) {
+	logger := OrNop(nil)
+	logger.With("key", "value").Error("discarded")
+	if logger.Enabled(LevelError) {
+		t.Errorf("no-op logger must not be enabled")
+	}
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"github.com/Sirupsen/logrus"
+)
+
+type logrusLogger struct {
+	entry *logrus.Entry
+}
+
+// NewLogrus returns a Logger that writes to logger
+func NewLogrus(logger *logrus.Logger) Logger {
+	return &logrusLogger{entry: logrus.NewEntry(logger)}
+}
+
+func (l *logrusLogger) withFields(keysAndValues []interface{}) *logrus.Entry {
+	if len(keysAndValues) == 0 {
+		return l.entry
+	}
+	data := make(logrus.Fields, len(keysAndValues)/2)
+	fields(keysAndValues, func(key string, value interface{}) {
+		data[key] = value
+	})
+	return l.entry.WithFields(data)
+}
+
+func (l *logrusLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.withFields(keysAndValues).Debug(msg)
+}
+
+func (l *logrusLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.withFields(keysAndValues).Info(msg)
+}
+
+func (l *logrusLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.withFields(keysAndValues).Warn(msg)
+}
+
+func (l *logrusLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.withFields(keysAndValues).Error(msg)
+}
+
+func (l *logrusLogger) With(keysAndValues ...interface{}) Logger {
+	return &logrusLogger{entry: l.withFields(keysAndValues)}
+}
+
+func (l *logrusLogger) Enabled(level Level) bool {
+	var logrusLevel logrus.Level
+	switch level {
+	case LevelDebug:
+		logrusLevel = logrus.DebugLevel
+	case LevelInfo:
+		logrusLevel = logrus.InfoLevel
+	case LevelWarn:
+		logrusLevel = logrus.WarnLevel
+	default:
+		logrusLevel = logrus.ErrorLevel
+	}
+	return l.entry.Logger.Level >= logrusLevel
+}
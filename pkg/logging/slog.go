@@ -0,0 +1,43 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlog returns a Logger that writes to logger
+func NewSlog(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, keysAndValues...)
+}
+
+func (l *slogLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Info(msg, keysAndValues...)
+}
+
+func (l *slogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn(msg, keysAndValues...)
+}
+
+func (l *slogLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, keysAndValues...)
+}
+
+func (l *slogLogger) With(keysAndValues ...interface{}) Logger {
+	return &slogLogger{logger: l.logger.With(keysAndValues...)}
+}
+
+func (l *slogLogger) Enabled(level Level) bool {
+	// slog levels are 4 apart starting with debug at -4
+	return l.logger.Enabled(context.Background(), slog.Level(level)*4)
+}
@@ -0,0 +1,32 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestSlog(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := NewSlog(slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	logger.Debug("not written")
+	logger.With("service", "account").Error("call failed", "code", 14)
+
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to decode %s: %v", out, err)
+	}
+	if entry["msg"] != "call failed" || entry["level"] != "ERROR" || entry["service"] != "account" ||
+		entry["code"] != float64(14) {
+		t.Errorf("got entry %v", entry)
+	}
+
+	if logger.Enabled(LevelDebug) || !logger.Enabled(LevelInfo) || !logger.Enabled(LevelWarn) {
+		t.Errorf("Enabled() does not match the slog level")
+	}
+}
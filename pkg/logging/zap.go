@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type zapLogger struct {
+	logger *zap.Logger
+	sugar  *zap.SugaredLogger
+}
+
+// NewZap returns a Logger that writes to logger. It is the default backend of micros services
+func NewZap(logger *zap.Logger) Logger {
+	// Callers are reported as the code calling Logger rather than the adapter
+	logger = logger.WithOptions(zap.AddCallerSkip(1))
+	return &zapLogger{logger: logger, sugar: logger.Sugar()}
+}
+
+func (l *zapLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.sugar.Debugw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.sugar.Infow(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.sugar.Warnw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.sugar.Errorw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) With(keysAndValues ...interface{}) Logger {
+	sugar := l.sugar.With(keysAndValues...)
+	return &zapLogger{logger: sugar.Desugar(), sugar: sugar}
+}
+
+func (l *zapLogger) Enabled(level Level) bool {
+	return l.logger.Core().Enabled(zapcore.Level(level))
+}
+
+// Zap returns the zap logger behind logger and whether logger is a zap adapter
+func Zap(logger Logger) (*zap.Logger, bool) {
+	if l, ok := logger.(*zapLogger); ok {
+		return l.logger.WithOptions(zap.AddCallerSkip(-1)), true
+	}
+	return nil, false
+}
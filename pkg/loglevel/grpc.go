@@ -0,0 +1,106 @@
+package loglevel
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ServiceName is the name of the gRPC log level admin service
+const ServiceName = "micros.loglevel.LogLevel"
+
+// AdminServer is the gRPC log level admin service. Levels are exchanged as structs with the fields of
+// Change and State since the service has no generated messages
+type AdminServer interface {
+	// GetLevel returns the State
+	GetLevel(context.Context, *emptypb.Empty) (*structpb.Struct, error)
+	// SetLevel applies a Change and returns the new State
+	SetLevel(context.Context, *structpb.Struct) (*structpb.Struct, error)
+}
+
+// RegisterAdminServer registers the log level admin service for c on s.
+// Methods are /micros.loglevel.LogLevel/GetLevel and /micros.loglevel.LogLevel/SetLevel
+func RegisterAdminServer(s *grpc.Server, c *Controller) {
+	s.RegisterService(&adminServiceDesc, &adminServer{controller: c})
+}
+
+type adminServer struct {
+	controller *Controller
+}
+
+func (srv *adminServer) GetLevel(ctx context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+	return stateStruct(srv.controller.State())
+}
+
+func (srv *adminServer) SetLevel(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	fields := req.GetFields()
+	change := &Change{
+		Level:  fields["level"].GetStringValue(),
+		Method: fields["method"].GetStringValue(),
+		TTL:    fields["ttl"].GetStringValue(),
+	}
+	if err := srv.controller.Apply(change); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return stateStruct(srv.controller.State())
+}
+
+func stateStruct(state *State) (*structpb.Struct, error) {
+	methods := make(map[string]interface{}, len(state.Methods))
+	for method, level := range state.Methods {
+		methods[method] = level
+	}
+	st, err := structpb.NewStruct(map[string]interface{}{"level": state.Level, "methods": methods})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return st, nil
+}
+
+var adminServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetLevel",
+			Handler: func(
+				srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor,
+			) (interface{}, error) {
+				in := &emptypb.Empty{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(AdminServer).GetLevel(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/GetLevel"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(AdminServer).GetLevel(ctx, req.(*emptypb.Empty))
+				})
+			},
+		},
+		{
+			MethodName: "SetLevel",
+			Handler: func(
+				srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor,
+			) (interface{}, error) {
+				in := &structpb.Struct{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(AdminServer).SetLevel(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/SetLevel"}
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(AdminServer).SetLevel(ctx, req.(*structpb.Struct))
+				})
+			},
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "micros/loglevel.proto",
+}
@@ -0,0 +1,91 @@
+package loglevel
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"time"
+)
+
+// Change is a request to change the global level or the level of a gRPC method
+type Change struct {
+	// Level is a zap level name e.g debug, info, warn or error
+	Level string `json:"level"`
+	// Method is a full gRPC method name; the global level is changed when empty
+	Method string `json:"method,omitempty"`
+	// TTL is how long the change lasts e.g 10m; the change is permanent when empty
+	TTL string `json:"ttl,omitempty"`
+}
+
+// State contains the global level and the levels set for gRPC methods
+type State struct {
+	Level   string            `json:"level"`
+	Methods map[string]string `json:"methods"`
+}
+
+// Apply applies the change
+func (c *Controller) Apply(change *Change) error {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(change.Level)); err != nil {
+		return errors.Wrapf(err, "invalid level %q", change.Level)
+	}
+
+	var ttl time.Duration
+	if change.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(change.TTL)
+		if err != nil || ttl < 0 {
+			return errors.Errorf("invalid ttl %q", change.TTL)
+		}
+	}
+
+	if change.Method != "" {
+		c.SetMethodLevel(change.Method, level, ttl)
+	} else {
+		c.SetLevel(level, ttl)
+	}
+
+	return nil
+}
+
+// State returns the current levels
+func (c *Controller) State() *State {
+	state := &State{Level: c.Level().String(), Methods: make(map[string]string)}
+	for method, level := range c.Methods() {
+		state.Methods[method] = level.String()
+	}
+	return state
+}
+
+// ServeHTTP serves the levels on GET, applies a JSON Change on PUT or POST and clears the level
+// of the method in the method query parameter on DELETE
+func (c *Controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		change := &Change{}
+		if err := json.NewDecoder(r.Body).Decode(change); err != nil {
+			http.Error(w, "invalid change: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.Apply(change); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		method := r.URL.Query().Get("method")
+		if method == "" {
+			http.Error(w, "missing method query parameter", http.StatusBadRequest)
+			return
+		}
+		c.ClearMethodLevel(method)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.State())
+}
@@ -0,0 +1,216 @@
+// Package loglevel changes the level of zap loggers at runtime, globally or for single gRPC methods
+package loglevel
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sync"
+	"time"
+)
+
+// Controller holds the global log level and the levels of gRPC methods whose logs need a different level
+type Controller struct {
+	level        zap.AtomicLevel
+	mu           sync.RWMutex
+	methods      map[string]zapcore.Level
+	globalTimer  *time.Timer
+	methodTimers map[string]*time.Timer
+}
+
+// NewController creates a controller with the given global level
+func NewController(level zapcore.Level) *Controller {
+	return &Controller{
+		level:        zap.NewAtomicLevelAt(level),
+		methods:      make(map[string]zapcore.Level),
+		methodTimers: make(map[string]*time.Timer),
+	}
+}
+
+// LevelOf returns the lowest level enabled by core, or FatalLevel when it is disabled
+func LevelOf(core zapcore.Core) zapcore.Level {
+	for level := zapcore.DebugLevel; level < zapcore.FatalLevel; level++ {
+		if core.Enabled(level) {
+			return level
+		}
+	}
+	return zapcore.FatalLevel
+}
+
+// AtomicLevel returns the global level
+func (c *Controller) AtomicLevel() zap.AtomicLevel {
+	return c.level
+}
+
+// Level returns the global level
+func (c *Controller) Level() zapcore.Level {
+	return c.level.Level()
+}
+
+// SetLevel changes the global level. When ttl is positive the previous level is restored after ttl
+func (c *Controller) SetLevel(level zapcore.Level, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous := c.level.Level()
+	c.level.SetLevel(level)
+
+	if c.globalTimer != nil {
+		c.globalTimer.Stop()
+		c.globalTimer = nil
+	}
+	if ttl > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			// A later change owns the level now
+			if c.globalTimer == timer {
+				c.level.SetLevel(previous)
+				c.globalTimer = nil
+			}
+		})
+		c.globalTimer = timer
+	}
+}
+
+// MethodLevel returns the level of a gRPC method e.g /account.AccountAPI/GetAccount and whether it is set
+func (c *Controller) MethodLevel(fullMethod string) (zapcore.Level, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	level, ok := c.methods[fullMethod]
+	return level, ok
+}
+
+// Methods returns the levels set for gRPC methods
+func (c *Controller) Methods() map[string]zapcore.Level {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	methods := make(map[string]zapcore.Level, len(c.methods))
+	for method, level := range c.methods {
+		methods[method] = level
+	}
+	return methods
+}
+
+// SetMethodLevel sets the level of logs written while handling a gRPC method. When ttl is positive
+// the method goes back to its previous level after ttl
+func (c *Controller) SetMethodLevel(fullMethod string, level zapcore.Level, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, hadPrevious := c.methods[fullMethod]
+	c.methods[fullMethod] = level
+
+	c.stopMethodTimer(fullMethod)
+	if ttl > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.methodTimers[fullMethod] != timer {
+				return
+			}
+			delete(c.methodTimers, fullMethod)
+			if hadPrevious {
+				c.methods[fullMethod] = previous
+			} else {
+				delete(c.methods, fullMethod)
+			}
+		})
+		c.methodTimers[fullMethod] = timer
+	}
+}
+
+// ClearMethodLevel makes a gRPC method use the global level again
+func (c *Controller) ClearMethodLevel(fullMethod string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopMethodTimer(fullMethod)
+	delete(c.methods, fullMethod)
+}
+
+func (c *Controller) stopMethodTimer(fullMethod string) {
+	if timer, ok := c.methodTimers[fullMethod]; ok {
+		timer.Stop()
+		delete(c.methodTimers, fullMethod)
+	}
+}
+
+// enabled reports whether a log at level should be written for the gRPC method
+func (c *Controller) enabled(fullMethod string, level zapcore.Level) bool {
+	if fullMethod != "" {
+		if methodLevel, ok := c.MethodLevel(fullMethod); ok {
+			return level >= methodLevel
+		}
+	}
+	return c.level.Enabled(level)
+}
+
+// minLevel is the lowest level enabled globally or for any method
+func (c *Controller) minLevel() zapcore.Level {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	min := c.level.Level()
+	for _, level := range c.methods {
+		if level < min {
+			min = level
+		}
+	}
+	return min
+}
+
+// WrapLogger returns logger with its level controlled by c. The level of the wrapped core is ignored
+func (c *Controller) WrapLogger(logger *zap.Logger) *zap.Logger {
+	return logger.WithOptions(zap.WrapCore(c.Core))
+}
+
+// Core wraps core so that its level is controlled by c. Loggers carrying the grpc.service and grpc.method
+// fields added by the grpc_zap interceptors use the level of the method when one is set
+func (c *Controller) Core(core zapcore.Core) zapcore.Core {
+	return &levelCore{Core: core, controller: c}
+}
+
+type levelCore struct {
+	zapcore.Core
+	controller *Controller
+	service    string
+	method     string
+}
+
+func (lc *levelCore) fullMethod() string {
+	if lc.service == "" || lc.method == "" {
+		return ""
+	}
+	return "/" + lc.service + "/" + lc.method
+}
+
+func (lc *levelCore) Enabled(level zapcore.Level) bool {
+	if lc.fullMethod() != "" {
+		return lc.controller.enabled(lc.fullMethod(), level)
+	}
+	return level >= lc.controller.minLevel()
+}
+
+func (lc *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *lc
+	clone.Core = lc.Core.With(fields)
+	for _, field := range fields {
+		if field.Type != zapcore.StringType {
+			continue
+		}
+		switch field.Key {
+		case "grpc.service":
+			clone.service = field.String
+		case "grpc.method":
+			clone.method = field.String
+		}
+	}
+	return &clone
+}
+
+func (lc *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if lc.controller.enabled(lc.fullMethod(), entry.Level) {
+		return checked.AddCore(entry, lc)
+	}
+	return checked
+}
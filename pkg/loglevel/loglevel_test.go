@@ -0,0 +1,219 @@
+package loglevel
+
+import (
+	"bytes"
+	"context"
+	"github.com/gidyon/micros/internal/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a buffer that can be written by timers while the test reads it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Sync() error { return nil }
+
+// take returns and resets the logged output
+func (b *syncBuffer) take() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := b.buf.String()
+	b.buf.Reset()
+	return out
+}
+
+// newLogger returns an info level logger controlled by a new controller
+func newLogger() (*zap.Logger, *Controller, *syncBuffer) {
+	out := &syncBuffer{}
+	encoder := zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "msg", LevelKey: "level",
+		EncodeLevel: zapcore.LowercaseLevelEncoder})
+	logger := zap.New(zapcore.NewCore(encoder, out, zapcore.InfoLevel))
+
+	c := NewController(LevelOf(logger.Core()))
+	return c.WrapLogger(logger), c, out
+}
+
+func TestSetLevel(t *testing.T) {
+	logger, c, out := newLogger()
+
+	if c.Level() != zapcore.InfoLevel {
+		t.Fatalf("initial level = %s, want info", c.Level())
+	}
+
+	logger.Debug("debug before change")
+	logger.Info("info before change")
+	got := out.take()
+	if strings.Contains(got, "debug before change") {
+		t.Errorf("debug log written before change:\n%s", got)
+	}
+	if !strings.Contains(got, "info before change") {
+		t.Errorf("info log not written:\n%s", got)
+	}
+
+	c.SetLevel(zapcore.DebugLevel, 0)
+	logger.Debug("after change")
+	if got := out.take(); !strings.Contains(got, "debug\tafter change") {
+		t.Errorf("debug log not written after change:\n%s", got)
+	}
+
+	c.SetLevel(zapcore.ErrorLevel, 0)
+	logger.Warn("warning")
+	if got := out.take(); got != "" {
+		t.Errorf("warning written at error level:\n%s", got)
+	}
+}
+
+func TestSetLevelTTL(t *testing.T) {
+	logger, c, out := newLogger()
+
+	c.SetLevel(zapcore.DebugLevel, 50*time.Millisecond)
+	logger.Debug("during ttl")
+	if got := out.take(); !strings.Contains(got, "during ttl") {
+		t.Errorf("debug log not written during ttl:\n%s", got)
+	}
+
+	testutil.WaitFor(t, "the ttl to expire", func() bool {
+		return c.Level() == zapcore.InfoLevel
+	})
+
+	logger.Debug("after ttl")
+	if got := out.take(); got != "" {
+		t.Errorf("debug log written after ttl expired:\n%s", got)
+	}
+}
+
+func TestSetMethodLevel(t *testing.T) {
+	logger, c, out := newLogger()
+
+	// The grpc_zap interceptors add these fields to the logger of each call
+	accountLogger := logger.With(zap.String("grpc.service", "account.AccountAPI"), zap.String("grpc.method", "GetAccount"))
+	otherLogger := logger.With(zap.String("grpc.service", "account.AccountAPI"), zap.String("grpc.method", "ListAccounts"))
+
+	c.SetMethodLevel("/account.AccountAPI/GetAccount", zapcore.DebugLevel, 0)
+
+	accountLogger.Debug("get account")
+	otherLogger.Debug("list accounts")
+	logger.Debug("no method")
+
+	got := out.take()
+	if !strings.Contains(got, "get account") {
+		t.Errorf("debug log for method with debug level not written:\n%s", got)
+	}
+	if strings.Contains(got, "list accounts") || strings.Contains(got, "no method") {
+		t.Errorf("debug log written for logger without method level:\n%s", got)
+	}
+
+	c.SetMethodLevel("/account.AccountAPI/ListAccounts", zapcore.ErrorLevel, 0)
+	otherLogger.Warn("list accounts warning")
+	if got := out.take(); got != "" {
+		t.Errorf("warning written for method with error level:\n%s", got)
+	}
+
+	c.ClearMethodLevel("/account.AccountAPI/GetAccount")
+	accountLogger.Debug("get account")
+	if got := out.take(); got != "" {
+		t.Errorf("debug log written after clearing method level:\n%s", got)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	_, c, _ := newLogger()
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "get", method: http.MethodGet, target: "/", wantStatus: http.StatusOK, wantBody: `"level":"info"`},
+		{name: "set global", method: http.MethodPut, target: "/", body: `{"level":"debug"}`,
+			wantStatus: http.StatusOK, wantBody: `"level":"debug"`},
+		{name: "set method", method: http.MethodPost, target: "/",
+			body:       `{"level":"error","method":"/account.AccountAPI/GetAccount","ttl":"1m"}`,
+			wantStatus: http.StatusOK, wantBody: `"/account.AccountAPI/GetAccount":"error"`},
+		{name: "clear method", method: http.MethodDelete, target: "/?method=/account.AccountAPI/GetAccount",
+			wantStatus: http.StatusOK, wantBody: `"methods":{}`},
+		{name: "invalid level", method: http.MethodPut, target: "/", body: `{"level":"loud"}`,
+			wantStatus: http.StatusBadRequest},
+		{name: "invalid ttl", method: http.MethodPut, target: "/", body: `{"level":"info","ttl":"soon"}`,
+			wantStatus: http.StatusBadRequest},
+		{name: "unsupported method", method: http.MethodPatch, target: "/", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAdminServer(t *testing.T) {
+	_, c, _ := newLogger()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	RegisterAdminServer(srv, c)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	cc, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(
+		func(context.Context, string) (net.Conn, error) { return lis.Dial() },
+	))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := structpb.NewStruct(map[string]interface{}{"level": "warn"})
+	resp := &structpb.Struct{}
+	if err := cc.Invoke(ctx, "/"+ServiceName+"/SetLevel", req, resp); err != nil {
+		t.Fatalf("SetLevel() error = %v", err)
+	}
+	if c.Level() != zapcore.WarnLevel {
+		t.Errorf("level = %s, want warn", c.Level())
+	}
+
+	resp = &structpb.Struct{}
+	if err := cc.Invoke(ctx, "/"+ServiceName+"/GetLevel", &emptypb.Empty{}, resp); err != nil {
+		t.Fatalf("GetLevel() error = %v", err)
+	}
+	if got := resp.GetFields()["level"].GetStringValue(); got != "warn" {
+		t.Errorf("GetLevel() level = %s, want warn", got)
+	}
+
+	req, _ = structpb.NewStruct(map[string]interface{}{"level": "loud"})
+	if err := cc.Invoke(ctx, "/"+ServiceName+"/SetLevel", req, &structpb.Struct{}); err == nil {
+		t.Errorf("SetLevel() expected error for invalid level")
+	}
+}
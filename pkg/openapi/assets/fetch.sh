@@ -0,0 +1,13 @@
+#!/bin/sh
+# Downloads the Swagger UI and Redoc files embedded by package openapi. Run through go generate
+# and commit the downloaded files so that services serve the pages without reaching a CDN
+set -e
+
+SWAGGER_UI_VERSION=3.52.5
+REDOC_VERSION=2.0.0-rc.45
+
+cd "$(dirname "$0")"
+
+curl -fsSL -o swagger-ui.css "https://unpkg.com/swagger-ui-dist@${SWAGGER_UI_VERSION}/swagger-ui.css"
+curl -fsSL -o swagger-ui-bundle.js "https://unpkg.com/swagger-ui-dist@${SWAGGER_UI_VERSION}/swagger-ui-bundle.js"
+curl -fsSL -o redoc.standalone.js "https://unpkg.com/redoc@${REDOC_VERSION}/bundles/redoc.standalone.js"
@@ -0,0 +1,236 @@
+// Package openapi merges and serves the swagger documents generated by protoc-gen-swagger
+// together with a Swagger UI or Redoc page
+package openapi
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Spec is a decoded swagger 2.0 document
+type Spec map[string]interface{}
+
+// Load reads and merges all .swagger.json files in fsys
+func Load(fsys fs.FS) (Spec, error) {
+	files := make([]string, 0)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(name, ".swagger.json") {
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list swagger files")
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no .swagger.json files found")
+	}
+
+	sort.Strings(files)
+
+	specs := make([]Spec, 0, len(files))
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", name)
+		}
+		spec := make(Spec)
+		if err := json.Unmarshal(data, &spec); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode %s", name)
+		}
+		specs = append(specs, spec)
+	}
+
+	return Merge(specs...)
+}
+
+// Merge merges swagger 2.0 documents into one. The info, schemes and security of the first document are used.
+// Paths, definitions and security definitions of all documents are combined; it is an error for two
+// documents to define the same operation or different definitions with the same name
+func Merge(specs ...Spec) (Spec, error) {
+	merged := make(Spec)
+	for i, spec := range specs {
+		if version, _ := spec["swagger"].(string); version != "2.0" {
+			return nil, errors.Errorf("document %d is not a swagger 2.0 document", i)
+		}
+
+		for key, value := range spec {
+			switch key {
+			case "paths":
+				err := mergePaths(object(merged, key), value)
+				if err != nil {
+					return nil, err
+				}
+			case "definitions", "securityDefinitions", "responses", "parameters":
+				err := mergeObjects(key, object(merged, key), value)
+				if err != nil {
+					return nil, err
+				}
+			case "tags":
+				merged[key] = mergeTags(merged[key], value)
+			case "consumes", "produces":
+				merged[key] = mergeStrings(merged[key], value)
+			default:
+				if _, ok := merged[key]; !ok {
+					merged[key] = value
+				}
+			}
+		}
+	}
+	return merged, nil
+}
+
+func object(spec Spec, key string) map[string]interface{} {
+	obj, ok := spec[key].(map[string]interface{})
+	if !ok {
+		obj = make(map[string]interface{})
+		spec[key] = obj
+	}
+	return obj
+}
+
+func mergePaths(dst map[string]interface{}, src interface{}) error {
+	paths, _ := src.(map[string]interface{})
+	for p, value := range paths {
+		operations, _ := value.(map[string]interface{})
+		existing, ok := dst[p].(map[string]interface{})
+		if !ok {
+			existing = make(map[string]interface{}, len(operations))
+			dst[p] = existing
+		}
+		for method, operation := range operations {
+			if _, ok := existing[method]; ok {
+				return errors.Errorf("operation %s %s is defined more than once", strings.ToUpper(method), p)
+			}
+			existing[method] = operation
+		}
+	}
+	return nil
+}
+
+func mergeObjects(key string, dst map[string]interface{}, src interface{}) error {
+	values, _ := src.(map[string]interface{})
+	for name, value := range values {
+		if existing, ok := dst[name]; ok && !reflect.DeepEqual(existing, value) {
+			return errors.Errorf("%s %s is defined differently in more than one document", key, name)
+		}
+		dst[name] = value
+	}
+	return nil
+}
+
+func mergeTags(dst, src interface{}) interface{} {
+	tags, _ := dst.([]interface{})
+	seen := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		if obj, ok := tag.(map[string]interface{}); ok {
+			name, _ := obj["name"].(string)
+			seen[name] = struct{}{}
+		}
+	}
+	srcTags, _ := src.([]interface{})
+	for _, tag := range srcTags {
+		obj, ok := tag.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := obj["name"].(string)
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func mergeStrings(dst, src interface{}) interface{} {
+	values, _ := dst.([]interface{})
+	srcValues, _ := src.([]interface{})
+	for _, value := range srcValues {
+		found := false
+		for _, existing := range values {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Options contains options for serving a swagger document
+type Options struct {
+	// Title replaces the title in the document info when set
+	Title string
+	// BasePath is the path the gateway is mounted on; the document basePath is set to it
+	BasePath string
+	// Port is the port the service is reachable on. The document host is set to the requested host
+	// name with this port; the requested host is used unchanged when it is zero
+	Port int
+	// UI is the documentation page served alongside the document; defaults to SwaggerUI
+	UI UI
+}
+
+// Handler serves spec as JSON with its host, basePath and schemes set from opt and the request
+func Handler(spec Spec, opt *Options) http.Handler {
+	if opt == nil {
+		opt = &Options{}
+	}
+
+	base := make(Spec, len(spec))
+	for key, value := range spec {
+		base[key] = value
+	}
+	if opt.Title != "" {
+		info := make(map[string]interface{})
+		if existing, ok := spec["info"].(map[string]interface{}); ok {
+			for key, value := range existing {
+				info[key] = value
+			}
+		}
+		info["title"] = opt.Title
+		base["info"] = info
+	}
+	if opt.BasePath != "" {
+		base["basePath"] = path.Clean("/" + opt.BasePath)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc := make(Spec, len(base)+2)
+		for key, value := range base {
+			doc[key] = value
+		}
+
+		host := r.Host
+		if opt.Port > 0 {
+			if hostname, _, err := net.SplitHostPort(host); err == nil {
+				host = hostname
+			}
+			host = net.JoinHostPort(host, strconv.Itoa(opt.Port))
+		}
+		doc["host"] = host
+
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		doc["schemes"] = []string{scheme}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+	})
+}
@@ -0,0 +1,188 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const accountSpec = `{
+  "swagger": "2.0",
+  "info": {"title": "account.proto", "version": "version not set"},
+  "consumes": ["application/json"],
+  "produces": ["application/json"],
+  "paths": {
+    "/api/accounts/{id}": {"get": {"operationId": "GetAccount"}}
+  },
+  "definitions": {
+    "protobufAny": {"type": "object"},
+    "accountAccount": {"type": "object"}
+  }
+}`
+
+const messageSpec = `{
+  "swagger": "2.0",
+  "info": {"title": "messaging.proto", "version": "version not set"},
+  "consumes": ["application/json"],
+  "produces": ["application/json"],
+  "paths": {
+    "/api/accounts/{id}": {"delete": {"operationId": "DeleteAccount"}},
+    "/api/messages": {"post": {"operationId": "SendMessage"}}
+  },
+  "definitions": {
+    "protobufAny": {"type": "object"},
+    "messagingMessage": {"type": "object"}
+  }
+}`
+
+func TestLoad(t *testing.T) {
+	spec, err := Load(fstest.MapFS{
+		"account/account.swagger.json":     {Data: []byte(accountSpec)},
+		"messaging/messaging.swagger.json": {Data: []byte(messageSpec)},
+		"README.md":                        {Data: []byte("not a document")},
+	})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	paths := spec["paths"].(map[string]interface{})
+	if len(paths) != 2 {
+		t.Errorf("got %d paths, want 2", len(paths))
+	}
+	if operations := paths["/api/accounts/{id}"].(map[string]interface{}); len(operations) != 2 {
+		t.Errorf("got %d operations for /api/accounts/{id}, want 2", len(operations))
+	}
+	if definitions := spec["definitions"].(map[string]interface{}); len(definitions) != 3 {
+		t.Errorf("got %d definitions, want 3", len(definitions))
+	}
+	if consumes := spec["consumes"].([]interface{}); len(consumes) != 1 {
+		t.Errorf("got consumes %v, want one media type", consumes)
+	}
+	if title := spec["info"].(map[string]interface{})["title"]; title != "account.proto" {
+		t.Errorf("got title %v, want info of first document", title)
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	decode := func(s string) Spec {
+		spec := make(Spec)
+		if err := json.Unmarshal([]byte(s), &spec); err != nil {
+			t.Fatal(err)
+		}
+		return spec
+	}
+
+	tests := []struct {
+		name  string
+		specs []Spec
+	}{
+		{name: "duplicate operation", specs: []Spec{decode(accountSpec), decode(accountSpec)}},
+		{name: "different definitions", specs: []Spec{
+			decode(accountSpec),
+			decode(`{"swagger": "2.0", "definitions": {"protobufAny": {"type": "string"}}}`),
+		}},
+		{name: "not swagger 2.0", specs: []Spec{decode(`{"openapi": "3.0.0"}`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Merge(tt.specs...); err == nil {
+				t.Errorf("Merge() expected error")
+			}
+		})
+	}
+
+	if _, err := Load(fstest.MapFS{}); err == nil {
+		t.Errorf("Load() expected error when there are no documents")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	spec, err := Load(fstest.MapFS{"account.swagger.json": {Data: []byte(accountSpec)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := Handler(spec, &Options{Title: "Accounts API", BasePath: "/api/", Port: 8443})
+
+	r := httptest.NewRequest(http.MethodGet, "/docs/swagger.json", nil)
+	r.Host = "accounts.example.com:80"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	doc := make(Spec)
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to decode document: %v", err)
+	}
+
+	if doc["host"] != "accounts.example.com:8443" {
+		t.Errorf("host = %v, want accounts.example.com:8443", doc["host"])
+	}
+	if doc["basePath"] != "/api" {
+		t.Errorf("basePath = %v, want /api", doc["basePath"])
+	}
+	if title := doc["info"].(map[string]interface{})["title"]; title != "Accounts API" {
+		t.Errorf("title = %v, want Accounts API", title)
+	}
+	if title := spec["info"].(map[string]interface{})["title"]; title != "account.proto" {
+		t.Errorf("Handler() modified the loaded document")
+	}
+}
+
+func TestUIHandler(t *testing.T) {
+	defer func(original fs.FS) { assets = original }(assets)
+	assets = fstest.MapFS{
+		"assets/swagger-ui.css":       {Data: []byte("body {}")},
+		"assets/swagger-ui-bundle.js": {Data: []byte("var SwaggerUIBundle;")},
+		"assets/redoc.standalone.js":  {Data: []byte("var Redoc;")},
+	}
+
+	tests := []struct {
+		ui    UI
+		want  string
+		asset string
+	}{
+		{ui: SwaggerUI, want: `SwaggerUIBundle({url: "/docs/swagger.json"`, asset: "swagger-ui-bundle.js"},
+		{ui: Redoc, want: `<redoc spec-url="/docs/swagger.json">`, asset: "redoc.standalone.js"},
+	}
+	for _, tt := range tests {
+		h := UIHandler(tt.ui, "Accounts API", "/docs/swagger.json")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+		if !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("UI %d page does not contain %q:\n%s", tt.ui, tt.want, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), `src="assets/`+tt.asset+`"`) || strings.Contains(w.Body.String(), "unpkg") {
+			t.Errorf("UI %d page does not load %s from the bundled assets:\n%s", tt.ui, tt.asset, w.Body)
+		}
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/assets/"+tt.asset, nil))
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/javascript") {
+			t.Errorf("UI %d asset status = %d, content type = %q", tt.ui, w.Code, w.Header().Get("Content-Type"))
+		}
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/assets/unknown.js", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("UI %d unknown asset status = %d, want %d", tt.ui, w.Code, http.StatusNotFound)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	UIHandler(NoUI, "", "/docs/swagger.json").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("NoUI status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	assets = fstest.MapFS{}
+	w = httptest.NewRecorder()
+	UIHandler(Redoc, "", "/docs/swagger.json").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("missing assets status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
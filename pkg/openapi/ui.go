@@ -0,0 +1,113 @@
+package openapi
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:generate sh assets/fetch.sh
+
+// UI is a page that renders a swagger document
+type UI int
+
+const (
+	// SwaggerUI serves Swagger UI
+	SwaggerUI UI = iota
+	// Redoc serves Redoc
+	Redoc
+	// NoUI serves only the document
+	NoUI
+)
+
+//go:embed assets
+var embeddedAssets embed.FS
+
+// assets holds the scripts and styles of the pages so that they are served by the service instead of a CDN
+var assets fs.FS = embeddedAssets
+
+// uiAssets are the files in assets each page needs
+var uiAssets = map[UI][]string{
+	SwaggerUI: {"swagger-ui.css", "swagger-ui-bundle.js"},
+	Redoc:     {"redoc.standalone.js"},
+}
+
+// The pages load their scripts and styles relative to the page from the assets served by UIHandler
+var uiTemplates = map[UI]*template.Template{
+	SwaggerUI: template.Must(template.New("swagger-ui").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="assets/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="assets/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = function () {
+      SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui", deepLinking: true});
+    };
+  </script>
+</body>
+</html>
+`)),
+	Redoc: template.Must(template.New("redoc").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+</head>
+<body>
+  <redoc spec-url="{{.SpecURL}}"></redoc>
+  <script src="assets/redoc.standalone.js"></script>
+</body>
+</html>
+`)),
+}
+
+// UIHandler serves a page that renders the swagger document at specURL with ui, together with the
+// scripts and styles of the page under assets/. It should be mounted on a subtree pattern such as /docs/
+func UIHandler(ui UI, title, specURL string) http.Handler {
+	tmpl, ok := uiTemplates[ui]
+	if !ok {
+		return http.NotFoundHandler()
+	}
+	files := make(map[string][]byte, len(uiAssets[ui]))
+	for _, name := range uiAssets[ui] {
+		data, err := fs.ReadFile(assets, "assets/"+name)
+		if err != nil {
+			msg := fmt.Sprintf("%s is not bundled with the service; run go generate in package openapi", name)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, msg, http.StatusInternalServerError)
+			})
+		}
+		files[name] = data
+	}
+	if title == "" {
+		title = "API documentation"
+	}
+	data := struct{ Title, SpecURL string }{Title: title, SpecURL: specURL}
+	started := time.Now()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/assets/") {
+			name := path.Base(r.URL.Path)
+			content, ok := files[name]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			http.ServeContent(w, r, name, started, bytes.NewReader(content))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		tmpl.Execute(w, data)
+	})
+}
@@ -0,0 +1,155 @@
+package pubsub
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"sync"
+)
+
+// Encoder converts a message into the response sent on a stream. Messages it returns nil for are skipped
+type Encoder func(msg *Message) (interface{}, error)
+
+// ProtoEncoder decodes payloads published with PublishProto into messages created by newMessage
+func ProtoEncoder(newMessage func() proto.Message) Encoder {
+	return func(msg *Message) (interface{}, error) {
+		m := newMessage()
+		if err := proto.Unmarshal(msg.Payload, m); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal message of topic %s", msg.Topic)
+		}
+		return m, nil
+	}
+}
+
+// PublishProto publishes m encoded with proto.Marshal to topic
+func PublishProto(ctx context.Context, publisher Publisher, topic string, m proto.Message) error {
+	payload, err := proto.Marshal(m)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal message for topic %s", topic)
+	}
+	return publisher.Publish(ctx, topic, payload)
+}
+
+// Serve subscribes to topics for as long as the client of stream is connected and forwards the messages to it
+func Serve(stream grpc.ServerStream, subscriber Subscriber, encode Encoder, topics ...string) error {
+	sub, err := subscriber.Subscribe(stream.Context(), topics...)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to subscribe: %v", err)
+	}
+	return Forward(stream, sub, encode)
+}
+
+// Forward sends the messages of sub to stream until the client goes away, the subscription is closed or a send
+// fails. The subscription is closed when it returns.
+//
+// Messages are sent from a separate goroutine so that a client that stops reading cannot block the handler:
+// once the subscription buffer fills up the subscriber is evicted and Forward returns ResourceExhausted, letting
+// the handler return and gRPC cancel the stream. The goroutine sends nothing once Forward returns; Forward waits
+// for it unless it is blocked sending to the client, in which case it exits when that send returns
+func Forward(stream grpc.ServerStream, sub *Subscription, encode Encoder) error {
+	defer sub.Close()
+
+	ctx := stream.Context()
+
+	s := &sender{stream: stream, sub: sub, encode: encode, stop: make(chan struct{})}
+	sent := make(chan error, 1)
+	go func() {
+		sent <- s.run(ctx)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = status.FromContextError(ctx.Err()).Err()
+		s.halt(sent)
+	case <-sub.Done():
+		s.halt(sent)
+	case err = <-sent:
+	}
+	if err != nil {
+		return err
+	}
+
+	switch err := sub.Err(); {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrSlowConsumer):
+		return status.Error(codes.ResourceExhausted, "client is not reading messages fast enough")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		return status.Errorf(codes.Unavailable, "subscription closed: %v", err)
+	}
+}
+
+// sender sends the messages of a subscription to a stream until it is halted
+type sender struct {
+	stream grpc.ServerStream
+	sub    *Subscription
+	encode Encoder
+	stop   chan struct{}
+
+	mu      sync.Mutex
+	halted  bool
+	sending bool
+}
+
+// halt stops the sender and waits for run to return on sent unless it is blocked in SendMsg
+func (s *sender) halt(sent <-chan error) {
+	s.mu.Lock()
+	s.halted = true
+	sending := s.sending
+	s.mu.Unlock()
+
+	close(s.stop)
+	if !sending {
+		<-sent
+	}
+}
+
+// run sends the messages of the subscription until it is closed, ctx is done, a send fails or the sender is halted
+func (s *sender) run(ctx context.Context) error {
+	for {
+		var msg *Message
+		select {
+		case <-s.stop:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-s.sub.Messages():
+			if !ok {
+				return nil
+			}
+			msg = m
+		}
+
+		resp, err := s.encode(msg)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to encode message: %v", err)
+		}
+		if resp == nil {
+			continue
+		}
+
+		s.mu.Lock()
+		if s.halted {
+			s.mu.Unlock()
+			return nil
+		}
+		s.sending = true
+		s.mu.Unlock()
+
+		err = s.stream.SendMsg(resp)
+
+		s.mu.Lock()
+		s.sending = false
+		s.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package pubsub
+
+import (
+	"context"
+	"github.com/gidyon/micros/internal/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStream records sent messages. Sends block while block is set
+type fakeStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	block chan struct{}
+
+	mu   sync.Mutex
+	sent []string
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeStream) SendMsg(m interface{}) error {
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, m.(*wrapperspb.StringValue).Value)
+	return nil
+}
+
+func (s *fakeStream) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+var encode = ProtoEncoder(func() proto.Message { return &wrapperspb.StringValue{} })
+
+func TestServe(t *testing.T) {
+	broker := NewMemoryBroker(nil)
+	defer broker.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &fakeStream{ctx: ctx}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(stream, broker, encode, "news")
+	}()
+
+	testutil.WaitFor(t, "subscription", func() bool { return subscribers(broker.hub, "news") == 1 })
+	for _, value := range []string{"a", "b"} {
+		if err := PublishProto(ctx, broker, "news", wrapperspb.String(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testutil.WaitFor(t, "sent messages", func() bool { return stream.count() == 2 })
+
+	cancel()
+	if err := <-done; status.Code(err) != codes.Canceled {
+		t.Errorf("err = %v, want code %v", err, codes.Canceled)
+	}
+	if n := subscribers(broker.hub, "news"); n != 0 {
+		t.Errorf("got %d subscribers after the client left, want 0", n)
+	}
+}
+
+func TestForwardEvictsSlowClient(t *testing.T) {
+	broker := NewMemoryBroker(&Options{Buffer: 1})
+	defer broker.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &fakeStream{ctx: ctx, block: make(chan struct{})}
+
+	sub, err := broker.Subscribe(ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Forward(stream, sub, encode)
+	}()
+
+	// the first message blocks the send, the second fills the buffer and the third evicts the client
+	for i := 0; i < 3; i++ {
+		if err := PublishProto(ctx, broker, "news", wrapperspb.String("update")); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			testutil.WaitFor(t, "blocked send", func() bool { return len(sub.Messages()) == 0 })
+		}
+	}
+
+	if err := <-done; status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("err = %v, want code %v", err, codes.ResourceExhausted)
+	}
+}
+
+func TestForwardBrokerClosed(t *testing.T) {
+	broker := NewMemoryBroker(nil)
+
+	stream := &fakeStream{ctx: context.Background()}
+	sub, err := broker.Subscribe(stream.ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Forward(stream, sub, encode)
+	}()
+
+	broker.Close()
+	if err := <-done; status.Code(err) != codes.Unavailable {
+		t.Errorf("err = %v, want code %v", err, codes.Unavailable)
+	}
+}
+
+func TestForwardStopsSendingOnReturn(t *testing.T) {
+	broker := NewMemoryBroker(&Options{Buffer: 10})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &fakeStream{ctx: ctx, block: make(chan struct{})}
+
+	sub, err := broker.Subscribe(ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Forward(stream, sub, encode)
+	}()
+
+	// the first message blocks the send and the others stay buffered
+	for i := 0; i < 5; i++ {
+		if err := PublishProto(ctx, broker, "news", wrapperspb.String("update")); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			testutil.WaitFor(t, "blocked send", func() bool { return len(sub.Messages()) == 0 })
+		}
+	}
+
+	// Forward returns while the send is blocked and the buffered messages are not sent once it completes
+	broker.Close()
+	<-done
+	close(stream.block)
+	testutil.WaitFor(t, "the send in flight", func() bool { return stream.count() >= 1 })
+	time.Sleep(50 * time.Millisecond)
+	if n := stream.count(); n != 1 {
+		t.Errorf("sent %d messages, want only the one in flight when Forward returned", n)
+	}
+}
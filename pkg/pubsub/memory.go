@@ -0,0 +1,45 @@
+package pubsub
+
+import (
+	"context"
+)
+
+// Options contains options for the in-memory broker
+type Options struct {
+	// Buffer is how many messages a subscriber may fall behind before it is evicted. Defaults to 64
+	Buffer int `json:"buffer" yaml:"buffer"`
+}
+
+// MemoryBroker delivers messages to the subscribers of this process. It is meant for single replica
+// services and tests
+type MemoryBroker struct {
+	hub *hub
+}
+
+// NewMemoryBroker creates an in-memory broker
+func NewMemoryBroker(opt *Options) *MemoryBroker {
+	if opt == nil {
+		opt = &Options{}
+	}
+	return &MemoryBroker{hub: newHub(opt.Buffer)}
+}
+
+// Publish delivers payload to the subscribers of topic
+func (broker *MemoryBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	if broker.hub.isClosed() {
+		return ErrClosed
+	}
+	broker.hub.dispatch(topic, payload)
+	return nil
+}
+
+// Subscribe subscribes to topics until ctx is done or the subscription is closed
+func (broker *MemoryBroker) Subscribe(ctx context.Context, topics ...string) (*Subscription, error) {
+	return broker.hub.subscribe(ctx, topics)
+}
+
+// Close closes the subscriptions of the broker
+func (broker *MemoryBroker) Close() error {
+	broker.hub.close()
+	return nil
+}
@@ -0,0 +1,251 @@
+// Package pubsub fans out messages published on any replica to the subscribers of every replica.
+//
+// Delivery is at-most-once and fire-and-forget: messages published while a subscriber is not connected are not
+// kept. Each subscription buffers the messages its consumer has not read yet; a consumer that falls further
+// behind than the buffer is evicted with ErrSlowConsumer instead of slowing down publishers and other
+// subscribers. Forward and Serve bridge subscriptions to gRPC server streams.
+package pubsub
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// Message is a message published to a topic
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// Publisher publishes messages to a topic
+type Publisher interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+}
+
+// Subscriber subscribes to topics. The subscription is closed when ctx is done
+type Subscriber interface {
+	Subscribe(ctx context.Context, topics ...string) (*Subscription, error)
+}
+
+// Broker publishes messages and delivers them to subscribers
+type Broker interface {
+	Publisher
+	Subscriber
+	// Close closes the subscriptions of the broker with ErrClosed
+	Close() error
+}
+
+var (
+	// ErrSlowConsumer is the error of subscriptions evicted because their buffer was full
+	ErrSlowConsumer = errors.New("subscriber is too slow and was evicted")
+	// ErrClosed is returned when using a closed broker and is the error of subscriptions closed with it
+	ErrClosed = errors.New("pubsub broker is closed")
+)
+
+const defaultBuffer = 64
+
+// Subscription receives the messages of its topics
+type Subscription struct {
+	topics   []string
+	messages chan *Message
+	done     chan struct{}
+	hub      *hub
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+// Topics returns the topics of the subscription
+func (sub *Subscription) Topics() []string {
+	return sub.topics
+}
+
+// Messages returns the channel of messages. It is closed when the subscription is closed, after the buffered
+// messages
+func (sub *Subscription) Messages() <-chan *Message {
+	return sub.messages
+}
+
+// Done returns a channel closed when the subscription is closed
+func (sub *Subscription) Done() <-chan struct{} {
+	return sub.done
+}
+
+// Err returns why the subscription was closed: ErrSlowConsumer, ErrClosed, the error of its context or nil
+// when it was closed with Close or is still open
+func (sub *Subscription) Err() error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.err
+}
+
+// Close unsubscribes from the topics
+func (sub *Subscription) Close() error {
+	sub.close(nil)
+	return nil
+}
+
+func (sub *Subscription) close(err error) {
+	sub.mu.Lock()
+	if !sub.closed {
+		sub.closeLocked(err)
+	}
+	sub.mu.Unlock()
+
+	sub.hub.remove(sub)
+}
+
+func (sub *Subscription) closeLocked(err error) {
+	sub.closed = true
+	sub.err = err
+	close(sub.messages)
+	close(sub.done)
+}
+
+// deliver buffers msg without blocking. It closes the subscription and returns false when the buffer is full
+func (sub *Subscription) deliver(msg *Message) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return true
+	}
+	select {
+	case sub.messages <- msg:
+		return true
+	default:
+		sub.closeLocked(ErrSlowConsumer)
+		return false
+	}
+}
+
+// hub keeps the subscriptions of a broker by topic and dispatches messages to them
+type hub struct {
+	buffer int
+	// join and leave are called with mu held when a topic gets its first subscriber or loses its last one
+	join  func(topic string) error
+	leave func(topic string)
+
+	mu     sync.RWMutex
+	topics map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+func newHub(buffer int) *hub {
+	if buffer <= 0 {
+		buffer = defaultBuffer
+	}
+	return &hub{buffer: buffer, topics: make(map[string]map[*Subscription]struct{})}
+}
+
+func (h *hub) subscribe(ctx context.Context, topics []string) (*Subscription, error) {
+	if len(topics) == 0 {
+		return nil, errors.New("at least one topic is required")
+	}
+
+	sub := &Subscription{
+		messages: make(chan *Message, h.buffer),
+		done:     make(chan struct{}),
+		hub:      h,
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil, ErrClosed
+	}
+	for _, topic := range topics {
+		subs, ok := h.topics[topic]
+		if ok {
+			if _, ok := subs[sub]; ok {
+				continue
+			}
+		} else {
+			if h.join != nil {
+				if err := h.join(topic); err != nil {
+					h.mu.Unlock()
+					sub.close(err)
+					return nil, err
+				}
+			}
+			subs = make(map[*Subscription]struct{})
+			h.topics[topic] = subs
+		}
+		subs[sub] = struct{}{}
+		sub.topics = append(sub.topics, topic)
+	}
+	h.mu.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.close(ctx.Err())
+		case <-sub.done:
+		}
+	}()
+
+	return sub, nil
+}
+
+// remove unsubscribes sub from its topics
+func (h *hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, topic := range sub.topics {
+		subs, ok := h.topics[topic]
+		if !ok {
+			continue
+		}
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
+			if h.leave != nil && !h.closed {
+				h.leave(topic)
+			}
+		}
+	}
+}
+
+// dispatch delivers a message to the subscribers of topic, evicting the ones that are full
+func (h *hub) dispatch(topic string, payload []byte) {
+	msg := &Message{Topic: topic, Payload: payload}
+
+	var evicted []*Subscription
+	h.mu.RLock()
+	for sub := range h.topics[topic] {
+		if !sub.deliver(msg) {
+			evicted = append(evicted, sub)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range evicted {
+		h.remove(sub)
+	}
+}
+
+// close closes every subscription with ErrClosed
+func (h *hub) close() {
+	h.mu.Lock()
+	h.closed = true
+	subs := make(map[*Subscription]struct{})
+	for _, topicSubs := range h.topics {
+		for sub := range topicSubs {
+			subs[sub] = struct{}{}
+		}
+	}
+	h.mu.Unlock()
+
+	for sub := range subs {
+		sub.close(ErrClosed)
+	}
+}
+
+func (h *hub) isClosed() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.closed
+}
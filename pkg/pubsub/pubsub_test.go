@@ -0,0 +1,154 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, sub *Subscription) *Message {
+	select {
+	case msg, ok := <-sub.Messages():
+		if !ok {
+			t.Fatalf("subscription closed: %v", sub.Err())
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	return nil
+}
+
+func subscribers(h *hub, topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic])
+}
+
+func TestMemoryBrokerFanOut(t *testing.T) {
+	broker := NewMemoryBroker(nil)
+	defer broker.Close()
+	ctx := context.Background()
+
+	first, err := broker.Subscribe(ctx, "orders", "payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := broker.Subscribe(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := broker.Publish(ctx, "orders", []byte("created")); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Publish(ctx, "payments", []byte("settled")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sub := range []*Subscription{first, second} {
+		if msg := receive(t, sub); msg.Topic != "orders" || string(msg.Payload) != "created" {
+			t.Errorf("unexpected message %+v", msg)
+		}
+	}
+	if msg := receive(t, first); msg.Topic != "payments" || string(msg.Payload) != "settled" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	select {
+	case msg := <-second.Messages():
+		t.Errorf("unexpected message %+v", msg)
+	default:
+	}
+
+	if _, err := broker.Subscribe(ctx); err == nil {
+		t.Error("expected error subscribing without topics")
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	broker := NewMemoryBroker(&Options{Buffer: 2})
+	defer broker.Close()
+	ctx := context.Background()
+
+	slow, err := broker.Subscribe(ctx, "ticks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := broker.Subscribe(ctx, "ticks")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := broker.Publish(ctx, "ticks", []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		receive(t, fast)
+	}
+
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("slow subscriber was not evicted")
+	}
+	if slow.Err() != ErrSlowConsumer {
+		t.Errorf("err = %v, want %v", slow.Err(), ErrSlowConsumer)
+	}
+
+	// buffered messages are still readable after eviction
+	var got int
+	for range slow.Messages() {
+		got++
+	}
+	if got != 2 {
+		t.Errorf("got %d buffered messages, want 2", got)
+	}
+
+	if n := subscribers(broker.hub, "ticks"); n != 1 {
+		t.Errorf("got %d subscribers, want 1", n)
+	}
+}
+
+func TestSubscriptionCleanup(t *testing.T) {
+	broker := NewMemoryBroker(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := broker.Subscribe(ctx, "alerts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := broker.Subscribe(context.Background(), "alerts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := broker.Subscribe(context.Background(), "alerts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	<-sub.Done()
+	if sub.Err() != context.Canceled {
+		t.Errorf("err = %v, want %v", sub.Err(), context.Canceled)
+	}
+
+	closed.Close()
+	if closed.Err() != nil {
+		t.Errorf("err = %v, want nil", closed.Err())
+	}
+	if n := subscribers(broker.hub, "alerts"); n != 1 {
+		t.Errorf("got %d subscribers, want 1", n)
+	}
+
+	broker.Close()
+	<-remaining.Done()
+	if remaining.Err() != ErrClosed {
+		t.Errorf("err = %v, want %v", remaining.Err(), ErrClosed)
+	}
+	if err := broker.Publish(context.Background(), "alerts", nil); err != ErrClosed {
+		t.Errorf("publish err = %v, want %v", err, ErrClosed)
+	}
+	if _, err := broker.Subscribe(context.Background(), "alerts"); err != ErrClosed {
+		t.Errorf("subscribe err = %v, want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,100 @@
+package pubsub
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// RedisOptions contains options for the redis broker
+type RedisOptions struct {
+	// Prefix is prepended to topics to get redis channel names. Defaults to pubsub:
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Buffer is how many messages a subscriber may fall behind before it is evicted. Defaults to 64
+	Buffer int `json:"buffer" yaml:"buffer"`
+}
+
+const defaultRedisPrefix = "pubsub:"
+
+// RedisBroker publishes messages with redis PUBLISH so that they reach the subscribers of every replica.
+// A broker uses a single redis connection for its subscriptions and subscribes to the channel of a topic
+// while at least one local subscription needs it
+type RedisBroker struct {
+	client *redis.Client
+	prefix string
+	pubsub *redis.PubSub
+	hub    *hub
+	done   chan struct{}
+}
+
+// NewRedisBroker creates a redis broker using client
+func NewRedisBroker(client *redis.Client, opt *RedisOptions) (*RedisBroker, error) {
+	if client == nil {
+		return nil, errors.New("redis client must not be nil")
+	}
+	if opt == nil {
+		opt = &RedisOptions{}
+	}
+
+	broker := &RedisBroker{
+		client: client,
+		prefix: opt.Prefix,
+		pubsub: client.Subscribe(),
+		hub:    newHub(opt.Buffer),
+		done:   make(chan struct{}),
+	}
+	if broker.prefix == "" {
+		broker.prefix = defaultRedisPrefix
+	}
+
+	broker.hub.join = func(topic string) error {
+		err := broker.pubsub.Subscribe(broker.Channel(topic))
+		return errors.Wrapf(err, "failed to subscribe to topic %s", topic)
+	}
+	broker.hub.leave = func(topic string) {
+		broker.pubsub.Unsubscribe(broker.Channel(topic))
+	}
+
+	go broker.receive(broker.pubsub.Channel())
+
+	return broker, nil
+}
+
+// Channel returns the name of the redis channel of topic
+func (broker *RedisBroker) Channel(topic string) string {
+	return broker.prefix + topic
+}
+
+// receive dispatches the messages of the redis connection until it is closed. The connection is pinged and
+// re-established by go-redis, which subscribes to the channels again
+func (broker *RedisBroker) receive(messages <-chan *redis.Message) {
+	defer close(broker.done)
+
+	for msg := range messages {
+		broker.hub.dispatch(strings.TrimPrefix(msg.Channel, broker.prefix), []byte(msg.Payload))
+	}
+}
+
+// Publish publishes payload to the subscribers of topic on every replica
+func (broker *RedisBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	if broker.hub.isClosed() {
+		return ErrClosed
+	}
+	err := broker.client.WithContext(ctx).Publish(broker.Channel(topic), payload).Err()
+	return errors.Wrapf(err, "failed to publish to topic %s", topic)
+}
+
+// Subscribe subscribes to topics until ctx is done or the subscription is closed. Messages published
+// before redis confirms the subscription of a new topic may be missed
+func (broker *RedisBroker) Subscribe(ctx context.Context, topics ...string) (*Subscription, error) {
+	return broker.hub.subscribe(ctx, topics)
+}
+
+// Close closes the subscriptions of the broker and its redis connection
+func (broker *RedisBroker) Close() error {
+	broker.hub.close()
+	err := broker.pubsub.Close()
+	<-broker.done
+	return errors.Wrap(err, "failed to close redis subscriptions")
+}
@@ -0,0 +1,68 @@
+package pubsub
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gidyon/micros/internal/testutil"
+	"github.com/go-redis/redis"
+	"testing"
+)
+
+func TestRedisBroker(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	// brokers on two replicas sharing redis
+	var brokers []*RedisBroker
+	for i := 0; i < 2; i++ {
+		broker, err := NewRedisBroker(redis.NewClient(&redis.Options{Addr: mr.Addr()}), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer broker.Close()
+		brokers = append(brokers, broker)
+	}
+
+	ctx := context.Background()
+	first, err := brokers[0].Subscribe(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := brokers[1].Subscribe(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := brokers[1].Subscribe(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each broker holds a single redis subscription per topic
+	testutil.WaitFor(t, "redis subscriptions", func() bool {
+		return mr.PubSubNumSub("pubsub:orders")["pubsub:orders"] == 2
+	})
+
+	if err := brokers[0].Publish(ctx, "orders", []byte("created")); err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range []*Subscription{first, second, third} {
+		if msg := receive(t, sub); msg.Topic != "orders" || string(msg.Payload) != "created" {
+			t.Errorf("unexpected message %+v", msg)
+		}
+	}
+
+	second.Close()
+	third.Close()
+	testutil.WaitFor(t, "redis unsubscribe", func() bool {
+		return mr.PubSubNumSub("pubsub:orders")["pubsub:orders"] == 1
+	})
+
+	brokers[0].Close()
+	<-first.Done()
+	if first.Err() != ErrClosed {
+		t.Errorf("err = %v, want %v", first.Err(), ErrClosed)
+	}
+}
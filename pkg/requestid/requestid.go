@@ -0,0 +1,174 @@
+// Package requestid propagates request ids across HTTP, the gRPC gateway and gRPC calls
+package requestid
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"regexp"
+)
+
+const (
+	// HeaderKey is the HTTP header carrying the request id
+	HeaderKey = "X-Request-ID"
+	// MetadataKey is the gRPC metadata key carrying the request id
+	MetadataKey = "x-request-id"
+)
+
+type ctxKey struct{}
+
+// validID limits incoming ids to a safe length and charset since they are logged and echoed back
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+// New generates a new request id
+func New() string {
+	return uuid.New().String()
+}
+
+// NewContext returns a copy of ctx carrying the request id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request id in ctx
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok && id != ""
+}
+
+// valid reports whether an incoming request id can be used as is
+func valid(id string) bool {
+	return validID.MatchString(id)
+}
+
+// fromIncomingMetadata returns the request id in the incoming gRPC metadata of ctx
+func fromIncomingMetadata(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	ids := md.Get(MetadataKey)
+	if len(ids) == 0 || !valid(ids[0]) {
+		return "", false
+	}
+	return ids[0], true
+}
+
+// Handler honours the X-Request-ID header of incoming requests, generating an id when absent.
+// The id is stored in the request context and echoed back in the response header
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the id may have been set by an outer handler
+		if _, ok := FromContext(r.Context()); ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		id := r.Header.Get(HeaderKey)
+		if !valid(id) {
+			id = New()
+		}
+		w.Header().Set(HeaderKey, id)
+		h.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// GatewayMetadata forwards the request id of a gateway request as gRPC metadata.
+// It is used with runtime.WithMetadata
+func GatewayMetadata(ctx context.Context, r *http.Request) metadata.MD {
+	id, ok := FromContext(ctx)
+	if !ok {
+		id = r.Header.Get(HeaderKey)
+		if !valid(id) {
+			return nil
+		}
+	}
+	return metadata.Pairs(MetadataKey, id)
+}
+
+// serverContext returns ctx carrying the incoming request id or a new one
+func serverContext(ctx context.Context) (context.Context, string) {
+	if id, ok := FromContext(ctx); ok {
+		return ctx, id
+	}
+	id, ok := fromIncomingMetadata(ctx)
+	if !ok {
+		id = New()
+	}
+	return NewContext(ctx, id), id
+}
+
+// UnaryServerInterceptor reads the request id from incoming metadata, generating one when absent,
+// and sends it back in the response header
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, id := serverContext(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, id))
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor reads the request id from incoming metadata, generating one when absent,
+// and sends it back in the response header
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		ctx, id := serverContext(ss.Context())
+		ss.SetHeader(metadata.Pairs(MetadataKey, id))
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+// outgoingContext adds the request id in ctx to the outgoing metadata
+func outgoingContext(ctx context.Context) context.Context {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(MetadataKey)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, MetadataKey, id)
+}
+
+// UnaryClientInterceptor propagates the request id in ctx to the called service
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		return invoker(outgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor propagates the request id in ctx to the called service
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		return streamer(outgoingContext(ctx), desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,98 @@
+package requestid
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{name: "incoming id is honoured", incoming: "abc-123", wantSame: true},
+		{name: "missing id is generated", incoming: ""},
+		{name: "invalid id is replaced", incoming: "bad id\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = FromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set(HeaderKey, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got == "" {
+				t.Fatal("no request id in context")
+			}
+			if echoed := w.Header().Get(HeaderKey); echoed != got {
+				t.Errorf("response header = %q, want %q", echoed, got)
+			}
+			if (got == tt.incoming) != tt.wantSame {
+				t.Errorf("request id = %q, incoming %q, wantSame %v", got, tt.incoming, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestHandlerNested(t *testing.T) {
+	var got string
+	h := Handler(Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	})))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if echoed := w.Header().Values(HeaderKey); len(echoed) != 1 || echoed[0] != got {
+		t.Errorf("response headers = %q, want [%q]", echoed, got)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	// Gateway forwards the id from the HTTP request context as metadata
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	md := GatewayMetadata(NewContext(context.Background(), "abc-123"), r)
+	if ids := md.Get(MetadataKey); len(ids) != 1 || ids[0] != "abc-123" {
+		t.Fatalf("GatewayMetadata() = %v", md)
+	}
+
+	// Server interceptor reads the id from incoming metadata
+	var serverID string
+	_, err := UnaryServerInterceptor()(
+		metadata.NewIncomingContext(context.Background(), md),
+		nil,
+		&grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			serverID, _ = FromContext(ctx)
+
+			// Client interceptor forwards the id to external services
+			return nil, UnaryClientInterceptor()(ctx, "/svc/Method", nil, nil, nil,
+				func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+					outgoing, _ := metadata.FromOutgoingContext(ctx)
+					if ids := outgoing.Get(MetadataKey); len(ids) != 1 || ids[0] != "abc-123" {
+						t.Errorf("outgoing metadata = %v", outgoing)
+					}
+					return nil
+				},
+			)
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverID != "abc-123" {
+		t.Errorf("server request id = %q, want %q", serverID, "abc-123")
+	}
+}
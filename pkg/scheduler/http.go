@@ -0,0 +1,18 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ServeHTTP serves the status of the jobs as JSON
+func (s *Scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jobs": s.Statuses()})
+}
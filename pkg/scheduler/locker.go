@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Locker provides the locks of single instance jobs
+type Locker interface {
+	// TryLock acquires the lock called name for at most ttl without waiting. It returns whether the lock was
+	// acquired and, if so, a function releasing it
+	TryLock(ctx context.Context, name string, ttl time.Duration) (release func(), acquired bool, err error)
+}
+
+// RedisLocker holds locks in redis keys that expire after the ttl
+type RedisLocker struct {
+	client *redis.Client
+}
+
+// NewRedisLocker creates a locker using client
+func NewRedisLocker(client *redis.Client) *RedisLocker {
+	return &RedisLocker{client: client}
+}
+
+// releaseScript deletes the lock only if it is still held by the caller
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// TryLock sets the lock key unless it exists
+func (locker *RedisLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	token := uuid.New().String()
+
+	acquired, err := locker.client.WithContext(ctx).SetNX(name, token, ttl).Result()
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to acquire lock %s", name)
+	}
+	if !acquired {
+		return nil, false, nil
+	}
+
+	release := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		releaseScript.Run(locker.client.WithContext(ctx), []string{name}, token)
+	}
+	return release, true, nil
+}
+
+// SQLLocker holds MySQL named locks with GET_LOCK. Locks are tied to a database connection, so they are
+// released when the connection is lost and the ttl is not used
+type SQLLocker struct {
+	db *sql.DB
+}
+
+// NewSQLLocker creates a locker using db
+func NewSQLLocker(db *sql.DB) *SQLLocker {
+	return &SQLLocker{db: db}
+}
+
+// TryLock acquires the named lock on a dedicated connection
+func (locker *SQLLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	conn, err := locker.db.Conn(ctx)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to get connection for lock")
+	}
+
+	var acquired sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&acquired)
+	if err != nil {
+		conn.Close()
+		return nil, false, errors.Wrapf(err, "failed to acquire lock %s", name)
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	release := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn.ExecContext(ctx, "DO RELEASE_LOCK(?)", name)
+		conn.Close()
+	}
+	return release, true, nil
+}
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestRedisLocker(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	locker := NewRedisLocker(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	release, acquired, err := locker.TryLock(ctx, "job", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("first lock: acquired = %v, err = %v", acquired, err)
+	}
+	if ttl := mr.TTL("job"); ttl != time.Minute {
+		t.Errorf("lock ttl = %v, want %v", ttl, time.Minute)
+	}
+
+	_, acquired, err = locker.TryLock(ctx, "job", time.Minute)
+	if err != nil || acquired {
+		t.Fatalf("second lock: acquired = %v, err = %v", acquired, err)
+	}
+
+	release()
+	if mr.Exists("job") {
+		t.Fatal("lock was not released")
+	}
+
+	// a release after the lock expired must not delete the lock of another holder
+	release, acquired, _ = locker.TryLock(ctx, "job", time.Minute)
+	if !acquired {
+		t.Fatal("lock was not acquired after release")
+	}
+	mr.Set("job", "other")
+	release()
+	if !mr.Exists("job") {
+		t.Error("release deleted a lock held by another instance")
+	}
+}
+
+func TestSQLLocker(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	locker := NewSQLLocker(db)
+	ctx := context.Background()
+
+	getLock := regexp.QuoteMeta("SELECT GET_LOCK(?, 0)")
+	mock.ExpectQuery(getLock).WithArgs("job").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("DO RELEASE_LOCK(?)")).WithArgs("job").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	release, acquired, err := locker.TryLock(ctx, "job", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("first lock: acquired = %v, err = %v", acquired, err)
+	}
+	release()
+
+	mock.ExpectQuery(getLock).WithArgs("job").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+
+	_, acquired, err = locker.TryLock(ctx, "job", time.Minute)
+	if err != nil || acquired {
+		t.Fatalf("second lock: acquired = %v, err = %v", acquired, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,310 @@
+// Package scheduler runs periodic jobs on cron schedules.
+//
+// Runs of a job never overlap: the next run is scheduled once the previous one returns. Each run gets a
+// timeout, panics are recovered and reported as failures, and jobs marked single instance only run on the
+// replica holding their lock. The lock is held until the next scheduled run so that replicas whose jitter
+// delays them past the end of a run skip it. The status of the last run of every job is kept for the admin
+// endpoint served by the Scheduler.
+package scheduler
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job is a periodic task. ctx is cancelled when the run times out or the scheduler stops
+type Job func(ctx context.Context) error
+
+// JobOptions contains options for a job
+type JobOptions struct {
+	// Jitter delays each run by a random duration up to Jitter, spreading the load of replicas
+	Jitter time.Duration `json:"jitter" yaml:"jitter"`
+	// Timeout limits how long a run may take. Defaults to 10 minutes
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// SingleInstance runs the job on a single replica at a time using Locker
+	SingleInstance bool `json:"singleInstance" yaml:"singleInstance"`
+	// Locker provides the lock of single instance jobs
+	Locker Locker `json:"-" yaml:"-"`
+}
+
+const defaultTimeout = 10 * time.Minute
+
+// Status is the state of a job
+type Status struct {
+	Name      string    `json:"name"`
+	Spec      string    `json:"spec"`
+	Running   bool      `json:"running"`
+	NextRun   time.Time `json:"nextRun,omitempty"`
+	LastStart time.Time `json:"lastStart,omitempty"`
+	LastEnd   time.Time `json:"lastEnd,omitempty"`
+	// LastError is the error of the last run or empty when it succeeded
+	LastError string `json:"lastError,omitempty"`
+	Runs      int64  `json:"runs"`
+	Failures  int64  `json:"failures"`
+	// Skipped counts the runs skipped because another replica held the lock
+	Skipped int64 `json:"skipped"`
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule cron.Schedule
+	fn       Job
+	opt      JobOptions
+
+	mu     sync.Mutex
+	status Status
+	// release releases the lock held since the last run of a single instance job
+	release func()
+}
+
+// Scheduler runs jobs until its context is done
+type Scheduler struct {
+	logger logging.Logger
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	ctx     context.Context
+	wg      sync.WaitGroup
+	running bool
+}
+
+// New creates a scheduler logging job failures with logger
+func New(logger logging.Logger) *Scheduler {
+	return &Scheduler{
+		logger: logging.OrNop(logger),
+		jobs:   make(map[string]*job),
+	}
+}
+
+// Add schedules fn with the cron spec e.g "0 3 * * *", "@hourly" or "@every 10m". Jobs added while the
+// scheduler is running start immediately
+func (s *Scheduler) Add(name, spec string, fn Job, opt *JobOptions) error {
+	switch {
+	case name == "":
+		return errors.New("job name must not be empty")
+	case fn == nil:
+		return errors.Errorf("job %s must not be nil", name)
+	}
+	if opt == nil {
+		opt = &JobOptions{}
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return errors.Wrapf(err, "invalid schedule %q for job %s", spec, name)
+	}
+
+	j := &job{name: name, spec: spec, schedule: schedule, fn: fn, opt: *opt}
+	if j.opt.Timeout <= 0 {
+		j.opt.Timeout = defaultTimeout
+	}
+	if j.opt.SingleInstance && j.opt.Locker == nil {
+		return errors.Errorf("single instance job %s requires a locker", name)
+	}
+	j.status = Status{Name: name, Spec: spec}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[name]; ok {
+		return errors.Errorf("job %s is already scheduled", name)
+	}
+	s.jobs[name] = j
+
+	if s.running {
+		s.start(j)
+	}
+	return nil
+}
+
+// Run runs the jobs until ctx is done and waits for running jobs to return
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return errors.New("scheduler is already running")
+	}
+	s.ctx = ctx
+	s.running = true
+	for _, j := range s.jobs {
+		s.start(j)
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return ctx.Err()
+}
+
+// start runs the loop of j. It is called with s.mu held
+func (s *Scheduler) start(j *job) {
+	ctx := s.ctx
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.loop(ctx, j)
+	}()
+}
+
+// loop runs j on its schedule until ctx is done
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	for {
+		next := j.schedule.Next(time.Now())
+		j.mu.Lock()
+		j.status.NextRun = next
+		j.mu.Unlock()
+
+		delay := time.Until(next)
+		if j.opt.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(j.opt.Jitter)))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			j.releaseLock()
+			return
+		case <-timer.C:
+		}
+
+		s.run(ctx, j, next)
+	}
+}
+
+// run runs j for the run scheduled at scheduled, holding its lock when it is single instance
+func (s *Scheduler) run(ctx context.Context, j *job, scheduled time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, j.opt.Timeout)
+	defer cancel()
+
+	if j.opt.SingleInstance {
+		// the lock kept since the previous run is released so that this replica competes for this run
+		j.releaseLock()
+
+		// the lock outlives the run timeout and the jitter of other replicas so that it is not taken over
+		// while the job returns or before it is held until the next run
+		release, acquired, err := j.opt.Locker.TryLock(
+			ctx, "scheduler:"+j.name, j.opt.Timeout+j.opt.Jitter+time.Minute,
+		)
+		if err != nil {
+			s.logger.Error("failed to lock job", "job", j.name, "error", err)
+			s.finish(j, time.Now(), errors.Wrap(err, "failed to lock job"))
+			return
+		}
+		if !acquired {
+			j.mu.Lock()
+			j.status.Skipped++
+			j.mu.Unlock()
+			return
+		}
+		defer j.holdLock(release, j.schedule.Next(scheduled))
+	}
+
+	start := time.Now()
+	j.mu.Lock()
+	j.status.Running = true
+	j.status.LastStart = start
+	j.mu.Unlock()
+
+	err := safeRun(ctx, j.fn)
+	if err != nil {
+		s.logger.Error("job failed", "job", j.name, "duration", time.Since(start).String(), "error", err)
+	}
+	s.finish(j, start, err)
+}
+
+// holdLock keeps the lock released by release until the next scheduled run at until
+func (j *job) holdLock(release func(), until time.Time) {
+	once := &sync.Once{}
+	releaseOnce := func() { once.Do(release) }
+	timer := time.AfterFunc(time.Until(until), releaseOnce)
+
+	j.mu.Lock()
+	j.release = func() {
+		timer.Stop()
+		releaseOnce()
+	}
+	j.mu.Unlock()
+}
+
+// releaseLock releases the lock held since the last run, if any
+func (j *job) releaseLock() {
+	j.mu.Lock()
+	release := j.release
+	j.release = nil
+	j.mu.Unlock()
+
+	if release != nil {
+		release()
+	}
+}
+
+// finish records the result of a run
+func (s *Scheduler) finish(j *job, start time.Time, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status.Running = false
+	j.status.LastStart = start
+	j.status.LastEnd = time.Now()
+	j.status.Runs++
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+	}
+}
+
+// safeRun calls fn, turning panics into errors
+func safeRun(ctx context.Context, fn Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.Errorf("job panicked: %v", p)
+		}
+	}()
+	return fn(ctx)
+}
+
+// Statuses returns the status of every job sorted by name
+func (s *Scheduler) Statuses() []Status {
+	s.mu.Lock()
+	jobs := make([]*job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(jobs))
+	for _, j := range jobs {
+		j.mu.Lock()
+		statuses = append(statuses, j.status)
+		j.mu.Unlock()
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Name < statuses[k].Name })
+	return statuses
+}
+
+// Health returns an error when the scheduler is not running. Failed runs do not make the scheduler unhealthy
+// since restarting the service does not fix them; they are reported by Statuses and the admin endpoint
+func (s *Scheduler) Health() error {
+	s.mu.Lock()
+	running := s.running
+	s.mu.Unlock()
+	if !running {
+		return errors.New("scheduler is not running")
+	}
+	return nil
+}
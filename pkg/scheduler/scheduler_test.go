@@ -0,0 +1,332 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gidyon/micros/internal/testutil"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// every is a schedule firing every d. cron specs cannot go below a second
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// addFast adds a job running every 10ms. It must be called before the scheduler runs
+func addFast(t *testing.T, s *Scheduler, name string, fn Job, opt *JobOptions) {
+	if err := s.Add(name, "@every 1s", fn, opt); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.jobs[name].schedule = every(10 * time.Millisecond)
+	s.mu.Unlock()
+}
+
+func status(s *Scheduler, name string) Status {
+	for _, status := range s.Statuses() {
+		if status.Name == name {
+			return status
+		}
+	}
+	return Status{}
+}
+
+func start(s *Scheduler) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestAdd(t *testing.T) {
+	fn := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name    string
+		job     string
+		spec    string
+		fn      Job
+		opt     *JobOptions
+		wantErr bool
+	}{
+		{name: "cron spec", job: "a", spec: "0 3 * * *", fn: fn},
+		{name: "descriptor", job: "b", spec: "@hourly", fn: fn},
+		{name: "interval", job: "c", spec: "@every 10m", fn: fn},
+		{name: "duplicate", job: "a", spec: "@hourly", fn: fn, wantErr: true},
+		{name: "invalid spec", job: "d", spec: "every day", fn: fn, wantErr: true},
+		{name: "empty name", job: "", spec: "@hourly", fn: fn, wantErr: true},
+		{name: "nil job", job: "e", spec: "@hourly", wantErr: true},
+		{name: "single instance without locker", job: "f", spec: "@hourly", fn: fn, opt: &JobOptions{SingleInstance: true}, wantErr: true},
+	}
+
+	s := New(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Add(tt.job, tt.spec, tt.fn, tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Add() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := len(s.Statuses()); got != 3 {
+		t.Errorf("got %d jobs, want 3", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := New(nil)
+
+	var runs int32
+	addFast(t, s, "count", func(context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}, nil)
+
+	if err := s.Health(); err == nil {
+		t.Error("expected health error before the scheduler runs")
+	}
+
+	stop := start(s)
+	testutil.WaitFor(t, "3 runs", func() bool { return atomic.LoadInt32(&runs) >= 3 })
+
+	if err := s.Health(); err != nil {
+		t.Errorf("unexpected health error: %v", err)
+	}
+
+	// jobs added while running start immediately
+	var lateRuns int32
+	err := s.Add("late", "@every 1s", func(context.Context) error {
+		atomic.AddInt32(&lateRuns, 1)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.WaitFor(t, "late job run", func() bool { return atomic.LoadInt32(&lateRuns) >= 1 })
+
+	stop()
+
+	got := status(s, "count")
+	if got.Runs < 3 || got.Failures != 0 || got.LastError != "" {
+		t.Errorf("unexpected status %+v", got)
+	}
+	if got.LastStart.IsZero() || got.LastEnd.Before(got.LastStart) {
+		t.Errorf("unexpected run times %+v", got)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	s := New(nil)
+
+	addFast(t, s, "error", func(context.Context) error {
+		return errors.New("boom")
+	}, nil)
+	addFast(t, s, "panic", func(context.Context) error {
+		panic("oops")
+	}, nil)
+	addFast(t, s, "timeout", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, &JobOptions{Timeout: 20 * time.Millisecond})
+
+	stop := start(s)
+	testutil.WaitFor(t, "failures", func() bool {
+		for _, status := range s.Statuses() {
+			if status.Failures == 0 {
+				return false
+			}
+		}
+		return true
+	})
+
+	statuses := s.Statuses()
+	if err := s.Health(); err != nil {
+		t.Errorf("failed runs made the scheduler unhealthy: %v", err)
+	}
+	stop()
+
+	want := map[string]string{
+		"error":   "boom",
+		"panic":   "job panicked: oops",
+		"timeout": context.DeadlineExceeded.Error(),
+	}
+	for _, status := range statuses {
+		if status.LastError != want[status.Name] {
+			t.Errorf("job %s: last error = %q, want %q", status.Name, status.LastError, want[status.Name])
+		}
+	}
+}
+
+func TestRunWaitsForJobs(t *testing.T) {
+	s := New(nil)
+
+	var (
+		started  = make(chan struct{})
+		once     sync.Once
+		finished int32
+	)
+	addFast(t, s, "slow", func(ctx context.Context) error {
+		once.Do(func() { close(started) })
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+		return nil
+	}, nil)
+
+	stop := start(s)
+	<-started
+	stop()
+
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Error("Run returned before the running job")
+	}
+}
+
+// fakeLocker grants the lock only when free is set
+type fakeLocker struct {
+	free     int32
+	released int32
+}
+
+func (locker *fakeLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	if atomic.LoadInt32(&locker.free) == 0 {
+		return nil, false, nil
+	}
+	return func() { atomic.AddInt32(&locker.released, 1) }, true, nil
+}
+
+func TestSingleInstance(t *testing.T) {
+	s := New(nil)
+	locker := &fakeLocker{}
+
+	var runs int32
+	addFast(t, s, "locked", func(context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}, &JobOptions{SingleInstance: true, Locker: locker})
+
+	stop := start(s)
+	defer stop()
+
+	testutil.WaitFor(t, "skipped runs", func() bool { return status(s, "locked").Skipped >= 2 })
+	if got := atomic.LoadInt32(&runs); got != 0 {
+		t.Fatalf("job ran %d times without the lock", got)
+	}
+
+	atomic.StoreInt32(&locker.free, 1)
+	testutil.WaitFor(t, "locked runs", func() bool { return atomic.LoadInt32(&runs) >= 2 })
+	if atomic.LoadInt32(&locker.released) == 0 {
+		t.Error("lock was not released")
+	}
+}
+
+// aligned is a schedule firing at multiples of d, like cron specs do on every replica
+type aligned time.Duration
+
+func (a aligned) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(a)).Add(time.Duration(a))
+}
+
+// memoryLocker is a locker shared by schedulers in the same process
+type memoryLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func (locker *memoryLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+	if locker.held[name] {
+		return nil, false, nil
+	}
+	locker.held[name] = true
+	return func() {
+		locker.mu.Lock()
+		delete(locker.held, name)
+		locker.mu.Unlock()
+	}, true, nil
+}
+
+func TestSingleInstanceWithJitter(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	locker := &memoryLocker{held: make(map[string]bool)}
+
+	var (
+		mu    sync.Mutex
+		ticks = make(map[time.Time]int)
+	)
+	fn := func(context.Context) error {
+		mu.Lock()
+		ticks[time.Now().Truncate(interval)]++
+		mu.Unlock()
+		return nil
+	}
+
+	// replicas run the job at random times within the jitter after each tick
+	for i := 0; i < 3; i++ {
+		s := New(nil)
+		err := s.Add("report", "@every 1s", fn, &JobOptions{SingleInstance: true, Locker: locker, Jitter: 30 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.jobs["report"].schedule = aligned(interval)
+		defer start(s)()
+	}
+
+	time.Sleep(10 * interval)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ticks) < 5 {
+		t.Errorf("job ran on %d ticks, want at least 5", len(ticks))
+	}
+	for tick, runs := range ticks {
+		if runs > 1 {
+			t.Errorf("job ran %d times for the tick at %s", runs, tick.Format(time.StampMilli))
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	s := New(nil)
+	if err := s.Add("cleanup", "@daily", func(context.Context) error { return nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var body struct {
+		Jobs []Status `json:"jobs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Jobs) != 1 || body.Jobs[0].Name != "cleanup" || body.Jobs[0].Spec != "@daily" {
+		t.Errorf("unexpected jobs %+v", body.Jobs)
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
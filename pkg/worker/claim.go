@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// autoClaim claims up to BatchSize messages idle for longer than the retry delay, starting at start.
+// It returns the claimed messages with their delivery counts and the id to continue from
+func (w *Worker) autoClaim(ctx context.Context, start string) ([]*Message, string, error) {
+	client := w.client.WithContext(ctx)
+
+	reply, err := client.Do(
+		"XAUTOCLAIM", w.opt.Stream, w.opt.Group, w.opt.Consumer,
+		int64(w.opt.RetryDelay/time.Millisecond), start, "COUNT", w.opt.BatchSize,
+	).Result()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to claim pending messages")
+	}
+
+	next, entries, err := parseAutoClaim(reply)
+	if err != nil {
+		return nil, "", err
+	}
+
+	messages := make([]*Message, 0, len(entries))
+	for _, entry := range entries {
+		msg := &Message{ID: entry.ID, Stream: w.opt.Stream, Values: entry.Values, Deliveries: 1}
+
+		pending, err := client.XPendingExt(&redis.XPendingExtArgs{
+			Stream:   w.opt.Stream,
+			Group:    w.opt.Group,
+			Start:    entry.ID,
+			End:      entry.ID,
+			Count:    1,
+			Consumer: w.opt.Consumer,
+		}).Result()
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "failed to get deliveries of message %s", entry.ID)
+		}
+		if len(pending) == 1 {
+			msg.Deliveries = pending[0].RetryCount
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, next, nil
+}
+
+// parseAutoClaim parses an XAUTOCLAIM reply: the next start id, the claimed entries and, since redis 7,
+// the ids of deleted entries
+func parseAutoClaim(reply interface{}) (string, []redis.XMessage, error) {
+	parts, ok := reply.([]interface{})
+	if !ok || len(parts) < 2 {
+		return "", nil, errors.Errorf("unexpected XAUTOCLAIM reply %v", reply)
+	}
+	next, ok := parts[0].(string)
+	if !ok {
+		return "", nil, errors.Errorf("unexpected XAUTOCLAIM cursor %v", parts[0])
+	}
+	entries, ok := parts[1].([]interface{})
+	if !ok {
+		return "", nil, errors.Errorf("unexpected XAUTOCLAIM entries %v", parts[1])
+	}
+
+	messages := make([]redis.XMessage, 0, len(entries))
+	for _, entry := range entries {
+		// entries deleted from the stream are nil before redis 7
+		fields, ok := entry.([]interface{})
+		if !ok || len(fields) != 2 {
+			continue
+		}
+		id, _ := fields[0].(string)
+		pairs, _ := fields[1].([]interface{})
+		values := make(map[string]interface{}, len(pairs)/2)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if field, ok := pairs[i].(string); ok {
+				values[field] = pairs[i+1]
+			}
+		}
+		messages = append(messages, redis.XMessage{ID: id, Values: values})
+	}
+
+	return next, messages, nil
+}
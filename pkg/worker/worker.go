@@ -0,0 +1,337 @@
+// Package worker processes redis streams with consumer groups.
+//
+// A Worker reads new messages of a stream and hands them to a handler running with the configured concurrency.
+// Messages are acknowledged when the handler succeeds. Messages whose handler fails, or whose consumer died,
+// stay pending and are reclaimed with XAUTOCLAIM once they have been idle for the retry delay. Messages that
+// fail more than MaxRetries times, or with a Permanent error, are moved to a dead-letter stream.
+package worker
+
+import (
+	"context"
+	"fmt"
+	"github.com/gidyon/micros/pkg/logging"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Message is a stream message delivered to a handler
+type Message struct {
+	ID     string
+	Stream string
+	Values map[string]interface{}
+	// Deliveries is how many times the message has been delivered, starting at 1
+	Deliveries int64
+}
+
+// Handler processes a message. The message is acknowledged when it returns nil and retried otherwise,
+// unless the error is Permanent
+type Handler func(ctx context.Context, msg *Message) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not retryable. The message is moved to the dead-letter stream immediately
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Options contains options for a stream worker
+type Options struct {
+	// Stream is the redis stream processed
+	Stream string `json:"stream" yaml:"stream"`
+	// Group is the consumer group of the worker. Workers sharing a group share the messages of the stream
+	Group string `json:"group" yaml:"group"`
+	// Consumer names this worker in the group. Defaults to hostname-pid
+	Consumer string `json:"consumer" yaml:"consumer"`
+	// Concurrency is the number of messages handled at the same time. Defaults to 1
+	Concurrency int `json:"concurrency" yaml:"concurrency"`
+	// BatchSize is the maximum number of messages read at a time. Defaults to 10
+	BatchSize int64 `json:"batchSize" yaml:"batchSize"`
+	// MaxRetries is how many times a failed message is retried before it is dead-lettered. Defaults to 5
+	MaxRetries int64 `json:"maxRetries" yaml:"maxRetries"`
+	// RetryDelay is how long a pending message stays idle before it is reclaimed. It must be longer than
+	// handlers take to run, otherwise messages being handled are delivered again. Defaults to 30 seconds
+	RetryDelay time.Duration `json:"retryDelay" yaml:"retryDelay"`
+	// DeadLetterStream receives the messages that failed too many times. Defaults to Stream:dead
+	DeadLetterStream string `json:"deadLetterStream" yaml:"deadLetterStream"`
+}
+
+const (
+	defaultBatchSize  = 10
+	defaultMaxRetries = 5
+	defaultRetryDelay = 30 * time.Second
+	readBlock         = time.Second
+	errorBackoff      = time.Second
+)
+
+// Worker processes the messages of a stream
+type Worker struct {
+	client  *redis.Client
+	opt     Options
+	handler Handler
+	logger  logging.Logger
+
+	running int32
+	mu      sync.Mutex
+	lastErr error
+}
+
+// New creates a worker processing the stream in opt with handler
+func New(client *redis.Client, opt *Options, handler Handler, logger logging.Logger) (*Worker, error) {
+	switch {
+	case client == nil:
+		return nil, errors.New("worker redis client must not be nil")
+	case opt == nil:
+		return nil, errors.New("worker options must not be nil")
+	case opt.Stream == "" || opt.Group == "":
+		return nil, errors.New("worker stream and group must not be empty")
+	case handler == nil:
+		return nil, errors.New("worker handler must not be nil")
+	}
+
+	w := &Worker{client: client, opt: *opt, handler: handler}
+	if w.opt.Consumer == "" {
+		hostname, _ := os.Hostname()
+		w.opt.Consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if w.opt.Concurrency <= 0 {
+		w.opt.Concurrency = 1
+	}
+	if w.opt.BatchSize <= 0 {
+		w.opt.BatchSize = defaultBatchSize
+	}
+	if w.opt.MaxRetries <= 0 {
+		w.opt.MaxRetries = defaultMaxRetries
+	}
+	if w.opt.RetryDelay <= 0 {
+		w.opt.RetryDelay = defaultRetryDelay
+	}
+	if w.opt.DeadLetterStream == "" {
+		w.opt.DeadLetterStream = w.opt.Stream + ":dead"
+	}
+	w.logger = logging.OrNop(logger).With("stream", w.opt.Stream, "group", w.opt.Group)
+
+	return w, nil
+}
+
+// Name returns the stream and group of the worker
+func (w *Worker) Name() string {
+	return w.opt.Stream + "/" + w.opt.Group
+}
+
+// Health returns an error when the worker is not running or its last redis call failed
+func (w *Worker) Health() error {
+	if atomic.LoadInt32(&w.running) == 0 {
+		return errors.Errorf("stream worker %s is not running", w.Name())
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lastErr != nil {
+		return errors.Wrapf(w.lastErr, "stream worker %s is failing", w.Name())
+	}
+	return nil
+}
+
+// setErr records the result of a redis call for Health
+func (w *Worker) setErr(err error) {
+	w.mu.Lock()
+	w.lastErr = err
+	w.mu.Unlock()
+}
+
+// Run processes messages until ctx is done. Handlers in progress are waited for before it returns
+func (w *Worker) Run(ctx context.Context) error {
+	err := w.client.WithContext(ctx).XGroupCreateMkStream(w.opt.Stream, w.opt.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrapf(err, "failed to create group %s for stream %s", w.opt.Group, w.opt.Stream)
+	}
+
+	atomic.StoreInt32(&w.running, 1)
+	defer atomic.StoreInt32(&w.running, 0)
+
+	messages := make(chan *Message)
+
+	handlers := &sync.WaitGroup{}
+	for i := 0; i < w.opt.Concurrency; i++ {
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			for msg := range messages {
+				w.process(ctx, msg)
+			}
+		}()
+	}
+
+	readers := &sync.WaitGroup{}
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		w.read(ctx, messages)
+	}()
+	go func() {
+		defer readers.Done()
+		w.reclaim(ctx, messages)
+	}()
+
+	readers.Wait()
+	close(messages)
+	handlers.Wait()
+
+	return ctx.Err()
+}
+
+// dispatch sends msg to the handlers. It returns false when ctx is done
+func dispatch(ctx context.Context, messages chan<- *Message, msg *Message) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case messages <- msg:
+		return true
+	}
+}
+
+// read reads new messages until ctx is done
+func (w *Worker) read(ctx context.Context, messages chan<- *Message) {
+	client := w.client.WithContext(ctx)
+
+	for ctx.Err() == nil {
+		streams, err := client.XReadGroup(&redis.XReadGroupArgs{
+			Group:    w.opt.Group,
+			Consumer: w.opt.Consumer,
+			Streams:  []string{w.opt.Stream, ">"},
+			Count:    w.opt.BatchSize,
+			Block:    readBlock,
+		}).Result()
+		if err == redis.Nil {
+			w.setErr(nil)
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				w.setErr(err)
+				w.logger.Error("failed to read stream", "error", err)
+				sleep(ctx, errorBackoff)
+			}
+			continue
+		}
+		w.setErr(nil)
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				msg := &Message{ID: message.ID, Stream: w.opt.Stream, Values: message.Values, Deliveries: 1}
+				if !dispatch(ctx, messages, msg) {
+					// undelivered messages stay pending and are reclaimed
+					return
+				}
+			}
+		}
+	}
+}
+
+// reclaim periodically claims messages that have been pending for longer than the retry delay
+func (w *Worker) reclaim(ctx context.Context, messages chan<- *Message) {
+	interval := w.opt.RetryDelay / 2
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+
+	for sleep(ctx, interval) {
+		start := "0-0"
+		for {
+			claimed, next, err := w.autoClaim(ctx, start)
+			if err != nil {
+				if ctx.Err() == nil {
+					w.setErr(err)
+					w.logger.Error("failed to reclaim pending messages", "error", err)
+				}
+				break
+			}
+
+			for _, msg := range claimed {
+				if !dispatch(ctx, messages, msg) {
+					return
+				}
+			}
+
+			if next == "0-0" || len(claimed) == 0 {
+				break
+			}
+			start = next
+		}
+	}
+}
+
+// process handles msg and acknowledges or dead-letters it
+func (w *Worker) process(ctx context.Context, msg *Message) {
+	err := w.handle(ctx, msg)
+	if err == nil {
+		if err := w.client.XAck(msg.Stream, w.opt.Group, msg.ID).Err(); err != nil {
+			w.logger.Error("failed to acknowledge message", "id", msg.ID, "error", err)
+		}
+		return
+	}
+
+	var permanent *permanentError
+	if !errors.As(err, &permanent) && msg.Deliveries <= w.opt.MaxRetries {
+		w.logger.Warn("message failed, it will be retried", "id", msg.ID, "deliveries", msg.Deliveries, "error", err)
+		return
+	}
+
+	if err := w.deadLetter(msg, err); err != nil {
+		w.logger.Error("failed to dead-letter message", "id", msg.ID, "error", err)
+		return
+	}
+	w.logger.Warn("message dead-lettered", "id", msg.ID, "deliveries", msg.Deliveries, "error", err)
+}
+
+// handle calls the handler, turning panics into errors
+func (w *Worker) handle(ctx context.Context, msg *Message) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.Errorf("handler panicked: %v", p)
+		}
+	}()
+	return w.handler(ctx, msg)
+}
+
+// deadLetter adds msg to the dead-letter stream and acknowledges it atomically
+func (w *Worker) deadLetter(msg *Message, cause error) error {
+	values := make(map[string]interface{}, len(msg.Values)+4)
+	for field, value := range msg.Values {
+		values[field] = value
+	}
+	values["dlq_stream"] = msg.Stream
+	values["dlq_id"] = msg.ID
+	values["dlq_group"] = w.opt.Group
+	values["dlq_error"] = cause.Error()
+
+	_, err := w.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.XAdd(&redis.XAddArgs{Stream: w.opt.DeadLetterStream, Values: values})
+		pipe.XAck(msg.Stream, w.opt.Group, msg.ID)
+		return nil
+	})
+	return errors.Wrap(err, "failed to add message to dead-letter stream")
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,178 @@
+package worker
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gidyon/micros/internal/testutil"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) *redis.Client {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	return redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+func addMessages(t *testing.T, client *redis.Client, stream string, jobs ...string) {
+	for _, job := range jobs {
+		if err := client.XAdd(&redis.XAddArgs{Stream: stream, Values: map[string]interface{}{"job": job}}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func pendingCount(t *testing.T, client *redis.Client, stream, group string) int64 {
+	pending, err := client.XPending(stream, group).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pending.Count
+}
+
+func TestWorker(t *testing.T) {
+	client := newTestClient(t)
+	addMessages(t, client, "jobs", "a", "b", "c", "d", "e")
+
+	var (
+		mu       sync.Mutex
+		handled  []string
+		attempts = map[string]int{}
+	)
+	handler := func(ctx context.Context, msg *Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		job := msg.Values["job"].(string)
+		attempts[job]++
+		switch {
+		case job == "b" && msg.Deliveries == 1:
+			return errors.New("temporary failure")
+		case job == "c":
+			return errors.New("always fails")
+		case job == "d":
+			return Permanent(errors.New("invalid job"))
+		case job == "e" && attempts[job] == 1:
+			panic("boom")
+		}
+		handled = append(handled, job)
+		return nil
+	}
+
+	w, err := New(client, &Options{
+		Stream: "jobs", Group: "billing", Consumer: "worker-1",
+		Concurrency: 3, MaxRetries: 2, RetryDelay: 20 * time.Millisecond,
+	}, handler, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	testutil.WaitFor(t, "dead letters", func() bool {
+		n, _ := client.XLen("jobs:dead").Result()
+		return n == 2
+	})
+	testutil.WaitFor(t, "handled jobs", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == 3
+	})
+	if err := w.Health(); err != nil {
+		t.Errorf("Health() = %v", err)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() = %v", err)
+	}
+	if w.Health() == nil {
+		t.Errorf("a stopped worker must be unhealthy")
+	}
+
+	sort.Strings(handled)
+	if len(handled) != 3 || handled[0] != "a" || handled[1] != "b" || handled[2] != "e" {
+		t.Errorf("handled %v", handled)
+	}
+	// c is retried twice before it is dead-lettered, d is dead-lettered at once
+	if attempts["c"] != 3 || attempts["d"] != 1 {
+		t.Errorf("attempts %v", attempts)
+	}
+	if n := pendingCount(t, client, "jobs", "billing"); n != 0 {
+		t.Errorf("%d messages still pending", n)
+	}
+
+	dead, err := client.XRange("jobs:dead", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadJobs := map[string]string{}
+	for _, msg := range dead {
+		deadJobs[msg.Values["job"].(string)] = msg.Values["dlq_error"].(string)
+	}
+	if deadJobs["c"] != "always fails" || deadJobs["d"] != "invalid job" {
+		t.Errorf("dead letters %v", deadJobs)
+	}
+}
+
+func TestWorkerReclaimsMessagesOfDeadConsumers(t *testing.T) {
+	client := newTestClient(t)
+	addMessages(t, client, "jobs", "a")
+
+	// another consumer reads the message and dies before acknowledging it
+	if err := client.XGroupCreateMkStream("jobs", "billing", "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.XReadGroup(&redis.XReadGroupArgs{
+		Group: "billing", Consumer: "dead", Streams: []string{"jobs", ">"}, Count: 1, Block: -1,
+	}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	handled := make(chan *Message, 1)
+	w, err := New(client, &Options{Stream: "jobs", Group: "billing", Consumer: "worker-1", RetryDelay: 20 * time.Millisecond},
+		func(ctx context.Context, msg *Message) error {
+			handled <- msg
+			return nil
+		}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	select {
+	case msg := <-handled:
+		if msg.Values["job"] != "a" || msg.Deliveries != 2 {
+			t.Errorf("got %+v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not reclaimed")
+	}
+	testutil.WaitFor(t, "acknowledgement", func() bool { return pendingCount(t, client, "jobs", "billing") == 0 })
+}
+
+func TestNew(t *testing.T) {
+	client := redis.NewClient(&redis.Options{})
+	handler := func(context.Context, *Message) error { return nil }
+	tests := []*Options{nil, {Stream: "jobs"}, {Group: "billing"}}
+	for _, opt := range tests {
+		if _, err := New(client, opt, handler, nil); err == nil {
+			t.Errorf("expected an error for %+v", opt)
+		}
+	}
+	if _, err := New(client, &Options{Stream: "jobs", Group: "billing"}, nil, nil); err == nil {
+		t.Errorf("expected an error for a nil handler")
+	}
+}
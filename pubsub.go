@@ -0,0 +1,29 @@
+package micros
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/pubsub"
+)
+
+// PubSub returns the pub/sub broker of the service. Messages are published with the service redis client so
+// that they reach the subscribers of every replica, or delivered in memory when the service has no redis
+// client. The broker is created on first use and closed when the service shuts down
+func (service *Service) PubSub() (pubsub.Broker, error) {
+	service.pubsubOnce.Do(func() {
+		if service.redisClient == nil {
+			service.pubsubBroker = pubsub.NewMemoryBroker(nil)
+		} else {
+			service.pubsubBroker, service.pubsubErr = pubsub.NewRedisBroker(service.redisClient, nil)
+			if service.pubsubErr != nil {
+				return
+			}
+		}
+
+		broker := service.pubsubBroker
+		service.addBackgroundTask("pubsub", func(ctx context.Context) error {
+			<-ctx.Done()
+			return broker.Close()
+		})
+	})
+	return service.pubsubBroker, service.pubsubErr
+}
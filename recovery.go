@@ -0,0 +1,35 @@
+package micros
+
+import (
+	"context"
+	grpc_middleware "github.com/gidyon/micros/pkg/grpc/middleware"
+	http_middleware "github.com/gidyon/micros/pkg/http"
+)
+
+// PanicHook is called with every panic recovered from a gRPC or REST handler, e.g. to increment a counter
+// or report the error. endpoint is the full gRPC method or the HTTP method and path
+type PanicHook func(ctx context.Context, endpoint string, p interface{}, stack []byte)
+
+// EnableRecovery recovers from panics in gRPC and REST handlers. Panics are logged with their stack trace
+// and request id, hooks are called and clients get codes.Internal or 500 Internal Server Error.
+// It must be called before InitGRPC for the gRPC interceptors to be installed
+func (service *Service) EnableRecovery(hooks ...PanicHook) {
+	service.recoveryEnabled = true
+	service.recoveryHooks = append(service.recoveryHooks, hooks...)
+}
+
+func (service *Service) grpcPanicHooks() []grpc_middleware.PanicHook {
+	hooks := make([]grpc_middleware.PanicHook, 0, len(service.recoveryHooks))
+	for _, hook := range service.recoveryHooks {
+		hooks = append(hooks, grpc_middleware.PanicHook(hook))
+	}
+	return hooks
+}
+
+func (service *Service) httpPanicHooks() []http_middleware.PanicHook {
+	hooks := make([]http_middleware.PanicHook, 0, len(service.recoveryHooks))
+	for _, hook := range service.recoveryHooks {
+		hooks = append(hooks, http_middleware.PanicHook(hook))
+	}
+	return hooks
+}
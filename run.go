@@ -4,19 +4,21 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"github.com/Sirupsen/logrus"
-	"github.com/gidyon/logger"
 	service_grpc "github.com/gidyon/micros/pkg/grpc"
+	grpc_middleware "github.com/gidyon/micros/pkg/grpc/middleware"
 	http_middleware "github.com/gidyon/micros/pkg/http"
+	"github.com/gidyon/micros/pkg/requestid"
 	micro_tls "github.com/gidyon/micros/utils/tls"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	"github.com/pkg/errors"
-	"go.uber.org/zap"
+	"golang.org/x/crypto/acme/autocert"
 	"google.golang.org/grpc/reflection"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
@@ -24,27 +26,99 @@ import (
 
 // Run multiplexes GRPC and HTTP server on the same port
 func (service *Service) Run(ctx context.Context, insecure bool) error {
+	atomic.StoreInt32(&service.running, 1)
+
 	if service.baseEndpoint == "" {
 		service.baseEndpoint = "/"
 	}
+	for _, pattern := range service.openAPIPatterns {
+		if pattern == service.baseEndpoint {
+			return errors.Errorf("service endpoint %q clashes with the OpenAPI path %q", service.baseEndpoint, pattern)
+		}
+	}
 	// Registration of service endpoint
-	service.httpMux.Handle(service.baseEndpoint, service.runtimeMux)
+	service.httpMux.Handle(service.baseEndpoint, service.RuntimeMux())
+
+	serverOptions := service.httpServerOptionsOrDefault()
 
 	// Apply middlewares
 	handler := http_middleware.Apply(service.Handler(), service.httpMiddlewares...)
 
+	// Recover from panics in REST handlers
+	if service.recoveryEnabled {
+		handler = http_middleware.Recovery(service.logger, service.httpPanicHooks()...)(handler)
+	}
+
+	// Limit REST request bodies
+	if serverOptions.MaxRequestBodyBytes > 0 {
+		handler = http_middleware.MaxBodySize(serverOptions.MaxRequestBodyBytes)(handler)
+	}
+
+	// Log REST requests
+	if service.accessLogOptions != nil {
+		accessLog, err := http_middleware.AccessLog(service.logger, service.accessLogOptions)
+		if err != nil {
+			return errors.Wrap(err, "failed to create access log middleware")
+		}
+		handler = accessLog(handler)
+	}
+
+	// Read or generate the request id of REST requests and echo it in the response
+	handler = requestid.Handler(handler)
+
 	// the grpcHandlerFunc takes an grpc server and a http muxer and will
 	// route the request to the right place at runtime.
 	// handler := grpcHandlerFunc(service.GRPCServer(), service.HTTPMux())
-	ghandler := grpcHandlerFunc(service.GRPCServer(), handler)
+	var grpcWebServer *grpcweb.WrappedGrpcServer
+	if service.grpcWebEnabled {
+		grpcWebServer = grpcweb.WrapServer(service.GRPCServer(), service.grpcWebOptions...)
+	}
+
+	ghandler := grpcHandlerFunc(service.GRPCServer(), grpcWebServer, handler)
+
+	// CORS is applied outermost so that it covers gRPC-Web requests too
+	if service.corsOptions != nil {
+		corsOptions := *service.corsOptions
+		corsOptions.GRPCWeb = corsOptions.GRPCWeb || service.grpcWebEnabled
+		cors, err := http_middleware.CORS(&corsOptions)
+		if err != nil {
+			return errors.Wrap(err, "failed to create CORS middleware")
+		}
+		ghandler = cors(ghandler)
+	}
 
 	// HTTP server configuration
 	httpServer := &http.Server{
 		Addr:              fmt.Sprintf(":%d", service.cfg.ServicePort()),
-		Handler:           ghandler,
-		ReadTimeout:       time.Duration(5 * time.Second),
-		ReadHeaderTimeout: time.Duration(5 * time.Second),
-		WriteTimeout:      time.Duration(5 * time.Second),
+		Handler:           exemptStreamsFromDeadlines(ghandler, serverOptions.StreamingPaths),
+		ReadTimeout:       serverOptions.ReadTimeout,
+		ReadHeaderTimeout: serverOptions.ReadHeaderTimeout,
+		WriteTimeout:      serverOptions.WriteTimeout,
+		IdleTimeout:       serverOptions.IdleTimeout,
+		MaxHeaderBytes:    serverOptions.MaxHeaderBytes,
+	}
+
+	// Certificate manager and HTTP-01 challenge server for autocert
+	var (
+		certManager     *autocert.Manager
+		challengeServer *http.Server
+		err             error
+	)
+
+	if !insecure && service.autocertOptions != nil {
+		certManager, err = micro_tls.NewAutocertManager(service.autocertOptions)
+		if err != nil {
+			return errors.Wrap(err, "failed to create autocert manager")
+		}
+
+		if addr := service.autocertOptions.HTTPChallengeAddr; addr != "" {
+			// Serves HTTP-01 challenges and redirects other requests to https
+			challengeServer = &http.Server{
+				Addr:              addr,
+				Handler:           certManager.HTTPHandler(nil),
+				ReadHeaderTimeout: time.Duration(5 * time.Second),
+			}
+		}
 	}
 
 	// Graceful shutdown of server
@@ -52,12 +126,11 @@ func (service *Service) Run(ctx context.Context, insecure bool) error {
 	signal.Notify(c, os.Interrupt)
 	go func() {
 		for range c {
-			if service.cfg.Logging() {
-				logger.Log.Warn(
-					"shutting service...", zap.String("service name", service.cfg.ServiceName()),
-				)
-			}
+			service.logger.Warn("shutting service...", "service name", service.cfg.ServiceName())
 			httpServer.Shutdown(ctx)
+			if challengeServer != nil {
+				challengeServer.Shutdown(ctx)
+			}
 
 			<-ctx.Done()
 		}
@@ -69,27 +142,33 @@ func (service *Service) Run(ctx context.Context, insecure bool) error {
 		return errors.Wrap(err, "failed to create TCP listener")
 	}
 
-	logMsgFn := func() {
-		if service.cfg.Logging() {
-			logger.Log.Info(
-				"<gRPC and REST> server for service running",
-				zap.String("service name", service.cfg.ServiceName()),
-				zap.Int("gRPC Port", service.cfg.ServicePort()),
-			)
-		} else {
-			logrus.Infof(
-				"<gRPC and REST> server for service running service: %s port: %d",
-				service.cfg.ServiceName(), service.cfg.ServicePort(),
-			)
-		}
-	}
+	// Background tasks such as stream workers stop once the server stops serving
+	service.startBackgroundTasks(ctx)
+	defer service.stopBackgroundTasks()
 
-	logMsgFn()
+	service.logger.Info(
+		"<gRPC and REST> server for service running",
+		"service name", service.cfg.ServiceName(),
+		"gRPC Port", service.cfg.ServicePort(),
+	)
 
 	if insecure {
 		return httpServer.Serve(lis)
 	}
 
+	if certManager != nil {
+		if challengeServer != nil {
+			go func() {
+				err := challengeServer.ListenAndServe()
+				if err != nil && err != http.ErrServerClosed {
+					service.logger.Error("autocert challenge server stopped", "error", err)
+				}
+			}()
+		}
+
+		return httpServer.Serve(tls.NewListener(lis, micro_tls.AutocertServerConfig(certManager)))
+	}
+
 	// Parse HTTP server TLS config
 	serverTLSsConfig, err := micro_tls.HTTPServerConfig()
 	if err != nil {
@@ -100,12 +179,18 @@ func (service *Service) Run(ctx context.Context, insecure bool) error {
 }
 
 // grpcHandlerFunc returns an http.Handler that delegates to grpcServer on incoming gRPC
-// connections or otherHandler otherwise. Copied from cockroachdb.
-func grpcHandlerFunc(grpcServer *grpc.Server, otherHandler http.Handler) http.Handler {
+// connections, to grpcWebServer on gRPC-Web requests when it is not nil or otherHandler otherwise.
+// Copied from cockroachdb.
+func grpcHandlerFunc(
+	grpcServer *grpc.Server, grpcWebServer *grpcweb.WrappedGrpcServer, otherHandler http.Handler,
+) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// TODO(tamird): point to merged gRPC code rather than a PR.
 		// This is a partial recreation of gRPC's internal checks https://github.com/grpc/grpc-go/pull/514/files#diff-95e9a25b738459a2d3030e1e6fa2a718R61
-		if r.ProtoMajor == 2 && strings.Contains(r.Header.Get("Content-Type"), "application/grpc") {
+		if grpcWebServer != nil && grpcWebServer.IsGrpcWebRequest(r) {
+			// application/grpc-web and application/grpc-web-text over HTTP/1.1 or HTTP/2
+			grpcWebServer.HandleGrpcWebRequest(w, r)
+		} else if r.ProtoMajor == 2 && strings.Contains(r.Header.Get("Content-Type"), "application/grpc") {
 			grpcServer.ServeHTTP(w, r)
 		} else {
 			otherHandler.ServeHTTP(w, r)
@@ -117,6 +202,21 @@ func grpcHandlerFunc(grpcServer *grpc.Server, otherHandler http.Handler) http.Ha
 // The method must be called before registering anything on the gRPC server or gRPC client connection.
 // When this method has been called, subsequent calls to add interceptors and/or options will not update the service
 func (service *Service) InitGRPC(ctx context.Context) error {
+	// request id is read first so that it is available to all other interceptors
+	service.gRPCUnaryInterceptors = append(
+		[]grpc.UnaryServerInterceptor{requestid.UnaryServerInterceptor()}, service.gRPCUnaryInterceptors...,
+	)
+	service.gRPCStreamInterceptors = append(
+		[]grpc.StreamServerInterceptor{requestid.StreamServerInterceptor()}, service.gRPCStreamInterceptors...,
+	)
+
+	// recovery is last so that the other interceptors see the recovered error
+	if service.recoveryEnabled {
+		unary, stream := grpc_middleware.AddRecovery(service.logger, service.grpcPanicHooks()...)
+		service.gRPCUnaryInterceptors = append(service.gRPCUnaryInterceptors, unary...)
+		service.gRPCStreamInterceptors = append(service.gRPCStreamInterceptors, stream...)
+	}
+
 	// client connection for the reverse gateway
 	clientConn, err := service_grpc.NewClientConn(
 		service.cfg,
@@ -0,0 +1,185 @@
+package micros
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	http_middleware "github.com/gidyon/micros/pkg/http"
+	"github.com/golang/protobuf/proto"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// grpcWebFrame frames msg as a gRPC-Web data frame
+func grpcWebFrame(t *testing.T, msg proto.Message) []byte {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+// readGRPCWebResponse splits a gRPC-Web response body into its message and trailers
+func readGRPCWebResponse(t *testing.T, body []byte) (*healthpb.HealthCheckResponse, string) {
+	resp := &healthpb.HealthCheckResponse{}
+	var trailers string
+	for len(body) >= 5 {
+		flag, size := body[0], binary.BigEndian.Uint32(body[1:5])
+		payload := body[5 : 5+size]
+		body = body[5+size:]
+		if flag&0x80 != 0 {
+			trailers = string(payload)
+			continue
+		}
+		if err := proto.Unmarshal(payload, resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp, trailers
+}
+
+func TestGRPCHandlerFuncGRPCWeb(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+	defer grpcServer.Stop()
+
+	rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("rest"))
+	})
+
+	cors, err := http_middleware.CORS(&http_middleware.CORSOptions{AllowedOrigins: []string{"https://app.example.com"}, GRPCWeb: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := cors(grpcHandlerFunc(grpcServer, grpcweb.WrapServer(grpcServer), rest))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	const checkURL = "/grpc.health.v1.Health/Check"
+	request := grpcWebFrame(t, &healthpb.HealthCheckRequest{})
+
+	tests := []struct {
+		name        string
+		contentType string
+		encode      func([]byte) []byte
+		decode      func([]byte) ([]byte, error)
+	}{
+		{
+			name:        "binary",
+			contentType: "application/grpc-web+proto",
+			encode:      func(b []byte) []byte { return b },
+			decode:      func(b []byte) ([]byte, error) { return b, nil },
+		},
+		{
+			name:        "text",
+			contentType: "application/grpc-web-text",
+			encode:      func(b []byte) []byte { return []byte(base64.StdEncoding.EncodeToString(b)) },
+			decode: func(b []byte) ([]byte, error) {
+				// frames are encoded separately, so decode each padded 4 byte group on its own
+				var decoded []byte
+				for i := 0; i+4 <= len(b); i += 4 {
+					part, err := base64.StdEncoding.DecodeString(string(b[i : i+4]))
+					if err != nil {
+						return nil, err
+					}
+					decoded = append(decoded, part...)
+				}
+				return decoded, nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, server.URL+checkURL, bytes.NewReader(tt.encode(request)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("X-Grpc-Web", "1")
+			req.Header.Set("Origin", "https://app.example.com")
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusOK)
+			}
+			if got := res.Header.Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+				t.Errorf("content type = %q, want %q", got, tt.contentType)
+			}
+			if got := res.Header.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+				t.Errorf("allowed origin = %q", got)
+			}
+			if got := strings.ToLower(res.Header.Get("Access-Control-Expose-Headers")); !strings.Contains(got, "grpc-status") {
+				t.Errorf("exposed headers = %q, want grpc-web headers", got)
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err = tt.decode(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, trailers := readGRPCWebResponse(t, body)
+			if resp.Status != healthpb.HealthCheckResponse_SERVING {
+				t.Errorf("health status = %v, want %v", resp.Status, healthpb.HealthCheckResponse_SERVING)
+			}
+			if !strings.Contains(trailers, "grpc-status: 0") {
+				t.Errorf("trailers = %q, want grpc-status 0", trailers)
+			}
+		})
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodOptions, server.URL+checkURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusNoContent)
+		}
+		if got := res.Header.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("allowed origin = %q", got)
+		}
+		if got := strings.ToLower(res.Header.Get("Access-Control-Allow-Headers")); !strings.Contains(got, "x-grpc-web") {
+			t.Errorf("allowed headers = %q, want x-grpc-web", got)
+		}
+	})
+
+	t.Run("rest", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/v1/accounts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		if string(body) != "rest" {
+			t.Errorf("body = %q, want REST handler response", body)
+		}
+	})
+}
@@ -0,0 +1,23 @@
+package micros
+
+import "testing"
+
+func TestAddRuntimeMuxOptionsAfterRuntimeMux(t *testing.T) {
+	service := &Service{}
+
+	if err := service.EnableErrorTranslation(); err != nil {
+		t.Fatalf("enabling error translation before the mux exists: %v", err)
+	}
+
+	service.RuntimeMux()
+
+	if err := service.AddRuntimeMuxOptions(); err == nil {
+		t.Error("expected an error adding mux options after RuntimeMux")
+	}
+	if err := service.EnableErrorTranslation(); err == nil {
+		t.Error("expected an error enabling error translation after RuntimeMux")
+	}
+	if err := service.EnableIdempotency(nil); err == nil {
+		t.Error("expected an error enabling idempotency after RuntimeMux")
+	}
+}
@@ -0,0 +1,83 @@
+//go:build gatewayv2
+// +build gatewayv2
+
+package micros
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/gateway"
+	"github.com/gidyon/micros/pkg/requestid"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+)
+
+// gatewayMux holds the grpc-gateway runtime mux and the options it is created with
+type gatewayMux struct {
+	mux     *runtime.ServeMux
+	options []runtime.ServeMuxOption
+}
+
+// GatewayRegisterFunc registers REST gateway handlers on mux e.g RegisterXHandler generated by grpc-gateway
+type GatewayRegisterFunc func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+
+// InProcessGateway adapts a function that calls RegisterXHandlerServer generated by grpc-gateway.
+// The handlers call the implementation directly so gRPC server interceptors and options are not applied
+func InProcessGateway(register func(ctx context.Context, mux *runtime.ServeMux) error) GatewayRegisterFunc {
+	return func(ctx context.Context, mux *runtime.ServeMux, _ *grpc.ClientConn) error {
+		return register(ctx, mux)
+	}
+}
+
+// AddRuntimeMuxOptions adds options such as header matchers, metadata annotators, error handlers
+// and marshalers to the gateway runtime mux. The mux is created with the options it has when RuntimeMux
+// is first called, so adding options afterwards fails
+func (service *Service) AddRuntimeMuxOptions(muxOptions ...runtime.ServeMuxOption) error {
+	if err := service.checkRuntimeMuxOptions(); err != nil {
+		return err
+	}
+	service.gateway.options = append(service.gateway.options, muxOptions...)
+	return nil
+}
+
+// checkRuntimeMuxOptions returns an error when the runtime mux has been created
+func (service *Service) checkRuntimeMuxOptions() error {
+	if service.gateway.mux != nil {
+		return errors.New("runtime mux options must be added before RuntimeMux is first called")
+	}
+	return nil
+}
+
+// addGatewayMetadata forwards the gRPC metadata returned by annotator for gateway requests
+func (service *Service) addGatewayMetadata(annotator func(context.Context, *http.Request) metadata.MD) error {
+	return service.AddRuntimeMuxOptions(runtime.WithMetadata(annotator))
+}
+
+// RuntimeMux returns the runtime muxer for the service. The muxer is created on first call
+// with the options added using AddRuntimeMuxOptions
+func (service *Service) RuntimeMux() *runtime.ServeMux {
+	if service.gateway.mux == nil {
+		service.gateway.mux = newRuntimeMux(service.gateway.options...)
+	}
+	return service.gateway.mux
+}
+
+// creates a http Muxer using runtime.NewServeMux. Options passed in are applied after the defaults
+func newRuntimeMux(muxOptions ...runtime.ServeMuxOption) *runtime.ServeMux {
+	defaultOptions := append(
+		gateway.DefaultServeMuxOptions(),
+		// Forward request id to gRPC server
+		runtime.WithMetadata(requestid.GatewayMetadata),
+		// Server streams are called with a nil message when they start
+		runtime.WithForwardResponseOption(func(ctx context.Context, _ http.ResponseWriter, resp proto.Message) error {
+			if resp == nil {
+				clearStreamDeadlines(ctx)
+			}
+			return nil
+		}),
+	)
+	return runtime.NewServeMux(append(defaultOptions, muxOptions...)...)
+}
@@ -0,0 +1,63 @@
+package micros
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/scheduler"
+	"github.com/pkg/errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// Schedule runs fn on the cron spec e.g "0 3 * * *", "@hourly" or "@every 10m" while the service runs.
+// Each run times out after 10 minutes and panics are reported as failures
+func (service *Service) Schedule(name, spec string, fn scheduler.Job) error {
+	return service.ScheduleWithOptions(name, spec, fn, nil)
+}
+
+// ScheduleWithOptions runs fn on the cron spec with the options in opt. Single instance jobs without a locker
+// are locked with the service redis client or, when there is none, the service MySQL database
+func (service *Service) ScheduleWithOptions(name, spec string, fn scheduler.Job, opt *scheduler.JobOptions) error {
+	if opt != nil && opt.SingleInstance && opt.Locker == nil {
+		jobOpt := *opt
+		switch {
+		case service.redisClient != nil:
+			jobOpt.Locker = scheduler.NewRedisLocker(service.redisClient)
+		case service.sqlDB != nil:
+			if err := service.requireMySQL("single instance job locking"); err != nil {
+				return err
+			}
+			jobOpt.Locker = scheduler.NewSQLLocker(service.sqlDB)
+		default:
+			return errors.Errorf("single instance job %s requires a redis client or SQL database", name)
+		}
+		opt = &jobOpt
+	}
+
+	if service.scheduler == nil {
+		service.scheduler = scheduler.New(service.logger.With("component", "scheduler"))
+		service.addBackgroundTask("scheduler", service.scheduler.Run)
+		service.AddHealthCheck("scheduler", func(context.Context) error {
+			return service.scheduler.Health()
+		})
+	}
+
+	return service.scheduler.Add(name, spec, fn, opt)
+}
+
+// RegisterSchedulerAdmin serves the status of the scheduled jobs as JSON at path. The endpoint is not
+// authenticated so path should only be reachable by operators
+func (service *Service) RegisterSchedulerAdmin(path string) error {
+	switch {
+	case service.scheduler == nil:
+		return errors.New("no job has been scheduled")
+	case atomic.LoadInt32(&service.running) == 1:
+		return errors.New("cannot register scheduler admin after service has started running")
+	}
+
+	if service.httpMux == nil {
+		service.httpMux = http.NewServeMux()
+	}
+	service.httpMux.Handle(path, service.scheduler)
+
+	return nil
+}
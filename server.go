@@ -0,0 +1,105 @@
+package micros
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPServerOptions contains timeouts and limits for the HTTP server that serves gRPC and REST.
+// Read and write timeouts don't apply to gRPC and gRPC-Web calls, gateway server streams and requests
+// to StreamingPaths so that streams are not cut off
+type HTTPServerOptions struct {
+	ReadTimeout       time.Duration `json:"readTimeout" yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `json:"readHeaderTimeout" yaml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `json:"writeTimeout" yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `json:"idleTimeout" yaml:"idleTimeout"`
+	MaxHeaderBytes    int           `json:"maxHeaderBytes" yaml:"maxHeaderBytes"`
+	// MaxRequestBodyBytes limits REST request bodies; zero means no limit
+	MaxRequestBodyBytes int64 `json:"maxRequestBodyBytes" yaml:"maxRequestBodyBytes"`
+	// StreamingPaths are path prefixes of streaming handlers e.g server-sent events served on the HTTP mux
+	StreamingPaths []string `json:"streamingPaths" yaml:"streamingPaths"`
+}
+
+// DefaultHTTPServerOptions returns the options used when none are set on the service
+func DefaultHTTPServerOptions() *HTTPServerOptions {
+	return &HTTPServerOptions{
+		ReadTimeout:       5 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      5 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+	}
+}
+
+// SetHTTPServerOptions overrides the default timeouts and limits of the HTTP server.
+// Zero fields keep their default values
+func (service *Service) SetHTTPServerOptions(opt *HTTPServerOptions) {
+	service.httpServerOptions = opt
+}
+
+// httpServerOptionsOrDefault merges the service options with the defaults
+func (service *Service) httpServerOptionsOrDefault() *HTTPServerOptions {
+	opt := DefaultHTTPServerOptions()
+	if service.httpServerOptions == nil {
+		return opt
+	}
+	if service.httpServerOptions.ReadTimeout != 0 {
+		opt.ReadTimeout = service.httpServerOptions.ReadTimeout
+	}
+	if service.httpServerOptions.ReadHeaderTimeout != 0 {
+		opt.ReadHeaderTimeout = service.httpServerOptions.ReadHeaderTimeout
+	}
+	if service.httpServerOptions.WriteTimeout != 0 {
+		opt.WriteTimeout = service.httpServerOptions.WriteTimeout
+	}
+	if service.httpServerOptions.IdleTimeout != 0 {
+		opt.IdleTimeout = service.httpServerOptions.IdleTimeout
+	}
+	if service.httpServerOptions.MaxHeaderBytes != 0 {
+		opt.MaxHeaderBytes = service.httpServerOptions.MaxHeaderBytes
+	}
+	opt.MaxRequestBodyBytes = service.httpServerOptions.MaxRequestBodyBytes
+	opt.StreamingPaths = service.httpServerOptions.StreamingPaths
+	return opt
+}
+
+// streamDeadlinesKey holds the function clearing the deadlines of a request in its context
+type streamDeadlinesKey struct{}
+
+// exemptStreamsFromDeadlines clears the server read and write deadlines for gRPC and gRPC-Web calls and
+// requests to streamingPaths since streams may last much longer than a REST request. Other requests get a
+// function in their context that clears the deadlines once they turn out to be streams, see clearStreamDeadlines
+func exemptStreamsFromDeadlines(h http.Handler, streamingPaths []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		clearDeadlines := func() {
+			rc.SetReadDeadline(time.Time{})
+			rc.SetWriteDeadline(time.Time{})
+		}
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			clearDeadlines()
+			h.ServeHTTP(w, r)
+			return
+		}
+		for _, path := range streamingPaths {
+			if strings.HasPrefix(r.URL.Path, path) {
+				clearDeadlines()
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), streamDeadlinesKey{}, clearDeadlines)))
+	})
+}
+
+// clearStreamDeadlines clears the server deadlines of the request of ctx. The gateway calls it when a server
+// stream starts
+func clearStreamDeadlines(ctx context.Context) {
+	if clearDeadlines, ok := ctx.Value(streamDeadlinesKey{}).(func()); ok {
+		clearDeadlines()
+	}
+}
@@ -0,0 +1,63 @@
+package micros
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExemptStreamsFromDeadlines(t *testing.T) {
+	mux := http.NewServeMux()
+	// slow handlers write after the write timeout has passed
+	mux.HandleFunc("/v1/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/v1/stream", func(w http.ResponseWriter, r *http.Request) {
+		clearStreamDeadlines(r.Context())
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/events/", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("ok"))
+	})
+
+	server := httptest.NewUnstartedServer(exemptStreamsFromDeadlines(mux, []string{"/events/"}))
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "deadline applies to REST", path: "/v1/slow", wantErr: true},
+		{name: "gateway stream", path: "/v1/stream"},
+		{name: "streaming path", path: "/events/orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := get(server.URL + tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && body != "ok" {
+				t.Errorf("body = %q, want ok", body)
+			}
+		})
+	}
+}
+
+func get(url string) (string, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	return string(body), err
+}
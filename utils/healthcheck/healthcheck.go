@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"github.com/gidyon/micros"
 	"github.com/gidyon/micros/pkg/conn"
+	"github.com/gidyon/micros/pkg/logging"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 )
@@ -37,6 +39,11 @@ func RegisterProbe(opt *ProbeOptions) http.HandlerFunc {
 	serviceNil := service == nil
 	cfgNil := cfg == nil
 
+	logger := logging.Nop()
+	if !serviceNil {
+		logger = logging.OrNop(service.Logger()).With("probe", opt.Type)
+	}
+
 	// apply defaults
 	if !serviceNil && !cfgNil {
 		switch opt.Type {
@@ -56,6 +63,7 @@ func RegisterProbe(opt *ProbeOptions) http.HandlerFunc {
 		// Handle any panic
 		defer func() {
 			if err := recover(); err != nil {
+				logger.Error("health check panicked", "panic", err)
 				errMsg := fmt.Sprintf("unexpected error: %v", err)
 				fmt.Fprintln(w, errMsg)
 			}
@@ -102,6 +110,17 @@ func RegisterProbe(opt *ProbeOptions) http.HandlerFunc {
 			}
 		}
 
+		// Check background workers and other registered components
+		failed := service.CheckHealth(nCtx)
+		names := make([]string, 0, len(failed))
+		for name := range failed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			errs = append(errs, fmt.Sprintf("%s is unhealthy: %v", name, failed[name]))
+		}
+
 		wg := &sync.WaitGroup{}
 
 		// check external services
@@ -109,6 +128,17 @@ func RegisterProbe(opt *ProbeOptions) http.HandlerFunc {
 			if !extSrv.Available() {
 				continue
 			}
+
+			// report services whose calls are failing fast
+			if cb := service.CircuitBreaker(extSrv.Name()); cb != nil {
+				if state := cb.State(); state != conn.CircuitClosed {
+					mu.Lock()
+					errMsg = fmt.Sprintf("circuit breaker for %s service is %s", extSrv.Name(), state)
+					errs = append(errs, errMsg)
+					mu.Unlock()
+				}
+			}
+
 			wg.Add(1)
 			extSrv := extSrv
 			// dials concurrently
@@ -116,11 +146,13 @@ func RegisterProbe(opt *ProbeOptions) http.HandlerFunc {
 				defer wg.Done()
 
 				cc, err := conn.DialService(nCtx, &conn.GRPCDialOptions{
+					ServiceName: extSrv.Name(),
 					Address:     extSrv.Address(),
 					TLSCertFile: extSrv.TLSCertFile(),
 					ServerName:  extSrv.ServerName(),
 					WithBlock:   true,
 					K8Service:   extSrv.K8Service(),
+					Logger:      logger,
 				})
 				if err != nil {
 					mu.Lock()
@@ -142,6 +174,7 @@ func RegisterProbe(opt *ProbeOptions) http.HandlerFunc {
 
 		// Check errors from external components
 		if len(errs) != 0 {
+			logger.Warn("health check failed", "errors", errs)
 			for _, err := range errs {
 				fmt.Fprintln(w, err)
 			}
@@ -0,0 +1,114 @@
+package microtls
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"net/http"
+	"time"
+)
+
+// AutocertOptions contains options for obtaining certificates automatically from an ACME CA
+type AutocertOptions struct {
+	// Hosts is the whitelist of host names certificates may be requested for
+	Hosts []string
+	// Email is the contact email sent to the CA
+	Email string
+	// Cache stores certificates and account keys; use DirCache or NewRedisCache
+	Cache autocert.Cache
+	// DirectoryURL is the ACME directory; defaults to Let's Encrypt production
+	DirectoryURL string
+	// HTTPClient is used to talk to the CA, e.g to trust a local pebble server
+	HTTPClient *http.Client
+	// HTTPChallengeAddr is where the HTTP-01 challenge server listens; empty disables HTTP-01
+	HTTPChallengeAddr string
+	// RenewBefore is how early certificates are renewed before they expire
+	RenewBefore time.Duration
+}
+
+// DirCache returns a certificate cache backed by a directory on disk
+func DirCache(dir string) autocert.Cache {
+	return autocert.DirCache(dir)
+}
+
+// NewAutocertManager creates an ACME certificate manager that handles TLS-ALPN-01 and HTTP-01 challenges
+func NewAutocertManager(opt *AutocertOptions) (*autocert.Manager, error) {
+	if opt == nil {
+		return nil, errors.New("nil autocert options")
+	}
+	if len(opt.Hosts) == 0 {
+		return nil, errors.New("autocert requires at least one host")
+	}
+	if opt.Cache == nil {
+		return nil, errors.New("autocert requires a certificate cache")
+	}
+
+	m := &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		HostPolicy:  autocert.HostWhitelist(opt.Hosts...),
+		Cache:       opt.Cache,
+		Email:       opt.Email,
+		RenewBefore: opt.RenewBefore,
+	}
+
+	if opt.DirectoryURL != "" || opt.HTTPClient != nil {
+		m.Client = &acme.Client{
+			DirectoryURL: opt.DirectoryURL,
+			HTTPClient:   opt.HTTPClient,
+		}
+	}
+
+	return m, nil
+}
+
+// AutocertServerConfig creates a tls config object for http server that gets certificates from the manager
+func AutocertServerConfig(m *autocert.Manager) *tls.Config {
+	tlsConfig := m.TLSConfig()
+	// h2 must come before the acme-tls/1 protocol used by TLS-ALPN-01 challenges
+	tlsConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	return tlsConfig
+}
+
+// redisCache implements autocert.Cache using redis
+type redisCache struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisCache returns a certificate cache backed by redis. Keys are stored under prefix
+func NewRedisCache(client *redis.Client, prefix string) autocert.Cache {
+	if prefix == "" {
+		prefix = "autocert:"
+	}
+	return &redisCache{client: client, prefix: prefix}
+}
+
+func (rc *redisCache) Get(ctx context.Context, name string) ([]byte, error) {
+	data, err := rc.client.WithContext(ctx).Get(rc.prefix + name).Bytes()
+	switch {
+	case err == redis.Nil:
+		return nil, autocert.ErrCacheMiss
+	case err != nil:
+		return nil, errors.Wrap(err, "failed to get certificate from redis")
+	}
+	return data, nil
+}
+
+func (rc *redisCache) Put(ctx context.Context, name string, data []byte) error {
+	err := rc.client.WithContext(ctx).Set(rc.prefix+name, data, 0).Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to save certificate to redis")
+	}
+	return nil
+}
+
+func (rc *redisCache) Delete(ctx context.Context, name string) error {
+	err := rc.client.WithContext(ctx).Del(rc.prefix + name).Err()
+	if err != nil {
+		return errors.Wrap(err, "failed to delete certificate from redis")
+	}
+	return nil
+}
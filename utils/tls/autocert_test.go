@@ -0,0 +1,77 @@
+package microtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+// TestAutocertPebble obtains a certificate from a local pebble ACME server.
+// Run pebble with PEBBLE_VA_ALWAYS_VALID=1 and set PEBBLE_DIRECTORY_URL (e.g https://localhost:14000/dir)
+// and PEBBLE_CA_FILE to pebble's minica.pem to enable the test.
+func TestAutocertPebble(t *testing.T) {
+	directoryURL := os.Getenv("PEBBLE_DIRECTORY_URL")
+	if directoryURL == "" {
+		t.Skip("PEBBLE_DIRECTORY_URL not set")
+	}
+
+	caPEM, err := ioutil.ReadFile(os.Getenv("PEBBLE_CA_FILE"))
+	if err != nil {
+		t.Fatalf("failed to read pebble CA: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+
+	m, err := NewAutocertManager(&AutocertOptions{
+		Hosts:        []string{"example.test"},
+		Cache:        DirCache(t.TempDir()),
+		DirectoryURL: directoryURL,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAutocertManager() error = %v", err)
+	}
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:      "example.test",
+		SupportedProtos: []string{"h2"},
+	})
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+	if cert.Leaf == nil || cert.Leaf.DNSNames[0] != "example.test" {
+		t.Errorf("GetCertificate() got certificate for %v", cert.Leaf)
+	}
+
+	// Hosts not whitelisted are refused
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.test"})
+	if err == nil {
+		t.Errorf("GetCertificate() expected error for host not in whitelist")
+	}
+}
+
+func TestNewAutocertManager(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     *AutocertOptions
+		wantErr bool
+	}{
+		{name: "nil options", opt: nil, wantErr: true},
+		{name: "no hosts", opt: &AutocertOptions{Cache: DirCache("certs")}, wantErr: true},
+		{name: "no cache", opt: &AutocertOptions{Hosts: []string{"example.com"}}, wantErr: true},
+		{name: "valid", opt: &AutocertOptions{Hosts: []string{"example.com"}, Cache: DirCache("certs")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAutocertManager(tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAutocertManager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
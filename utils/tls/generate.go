@@ -0,0 +1,196 @@
+package microtls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultHosts are the SANs used when no hosts are passed to GenerateCertificates
+var DefaultHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// GenerateOptions contains options for generating a development CA and leaf certificate
+type GenerateOptions struct {
+	// Hosts are DNS names and IP addresses added as SANs to the leaf certificate
+	Hosts []string
+	// Organization is the subject organization of both certificates
+	Organization string
+	// ValidFor is how long the certificates are valid for
+	ValidFor time.Duration
+}
+
+// Certificates contains PEM encoded CA and leaf certificates together with the leaf private key
+type Certificates struct {
+	CACert []byte
+	CAKey  []byte
+	Cert   []byte
+	Key    []byte
+}
+
+// GenerateCertificates creates a self-signed CA and a leaf certificate signed by it.
+// The leaf certificate is valid for both server and client authentication.
+func GenerateCertificates(opt *GenerateOptions) (*Certificates, error) {
+	if opt == nil {
+		opt = &GenerateOptions{}
+	}
+	hosts := opt.Hosts
+	if len(hosts) == 0 {
+		hosts = DefaultHosts
+	}
+	org := opt.Organization
+	if org == "" {
+		org = "micros development"
+	}
+	validFor := opt.ValidFor
+	if validFor == 0 {
+		validFor = 365 * 24 * time.Hour
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(validFor)
+
+	// Certificate authority
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate CA key")
+	}
+
+	caSerial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          caSerial,
+		Subject:               pkix.Name{Organization: []string{org}, CommonName: org + " CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create CA certificate")
+	}
+
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse CA certificate")
+	}
+
+	// Leaf certificate
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate key")
+	}
+
+	leafSerial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: leafSerial,
+		Subject:      pkix.Name{Organization: []string{org}, CommonName: hosts[0]},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			leafTemplate.IPAddresses = append(leafTemplate.IPAddresses, ip)
+		} else {
+			leafTemplate.DNSNames = append(leafTemplate.DNSNames, host)
+		}
+	}
+
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create certificate")
+	}
+
+	caKeyPEM, err := encodeKey(caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	leafKeyPEM, err := encodeKey(leafKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Certificates{
+		CACert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		CAKey:  caKeyPEM,
+		// The chain is appended so that peers only trusting the leaf can still verify it
+		Cert: append(
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...,
+		),
+		Key: leafKeyPEM,
+	}, nil
+}
+
+// WriteFiles writes the certificates to dir as ca.pem, ca-key.pem, cert.pem and key.pem
+func (certs *Certificates) WriteFiles(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", dir)
+	}
+
+	files := []struct {
+		name string
+		data []byte
+		perm os.FileMode
+	}{
+		{"ca.pem", certs.CACert, 0644},
+		{"ca-key.pem", certs.CAKey, 0600},
+		{"cert.pem", certs.Cert, 0644},
+		{"key.pem", certs.Key, 0600},
+	}
+
+	for _, file := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, file.name), file.data, file.perm)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write %s", file.name)
+		}
+	}
+
+	return nil
+}
+
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate serial number")
+	}
+	return serial, nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal private key")
+	}
+	buf := &bytes.Buffer{}
+	err = pem.Encode(buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode private key")
+	}
+	return buf.Bytes(), nil
+}
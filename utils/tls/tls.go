@@ -5,7 +5,9 @@ import (
 	"crypto/x509"
 	"github.com/pkg/errors"
 	"io/ioutil"
+	"os"
 	"strings"
+	"sync"
 )
 
 var (
@@ -13,6 +15,13 @@ var (
 	key = "certs/key.pem"
 )
 
+var (
+	devMu    sync.Mutex
+	devMode  bool
+	devHosts []string
+	devCerts *Certificates
+)
+
 // SetKeyAndCertPaths initializes path to private key and certificate
 func SetKeyAndCertPaths(keyPath, certPath string) {
 	if strings.TrimSpace(keyPath) != "" {
@@ -23,20 +32,63 @@ func SetKeyAndCertPaths(keyPath, certPath string) {
 	}
 }
 
+// SetDevMode enables or disables the development fallback. When enabled and the cert or key file
+// is missing, GetCert uses a self-signed certificate generated in memory for the given hosts.
+func SetDevMode(enabled bool, hosts ...string) {
+	devMu.Lock()
+	defer devMu.Unlock()
+	devMode = enabled
+	devHosts = hosts
+	devCerts = nil
+}
+
 // GetCert returns a certificate pair, pool and an error
 func GetCert() (*tls.Certificate, *x509.CertPool, error) {
 	// Read certificate
 	serverCrt, err := ioutil.ReadFile(crt)
 	if err != nil {
+		if os.IsNotExist(err) && isDevMode() {
+			return devCert()
+		}
 		return nil, nil, errors.Wrap(err, "failed to read cert file")
 	}
 
 	// Read private key
 	serverKey, err := ioutil.ReadFile(key)
 	if err != nil {
+		if os.IsNotExist(err) && isDevMode() {
+			return devCert()
+		}
 		return nil, nil, errors.Wrap(err, "failed to read key file")
 	}
 
+	return parseCert(serverCrt, serverKey)
+}
+
+func isDevMode() bool {
+	devMu.Lock()
+	defer devMu.Unlock()
+	return devMode
+}
+
+// devCert returns the in-memory development certificate, generating it on first use.
+// The same certificate is reused so that servers and clients in the process trust each other.
+func devCert() (*tls.Certificate, *x509.CertPool, error) {
+	devMu.Lock()
+	defer devMu.Unlock()
+
+	if devCerts == nil {
+		certs, err := GenerateCertificates(&GenerateOptions{Hosts: devHosts})
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to generate development certificate")
+		}
+		devCerts = certs
+	}
+
+	return parseCert(devCerts.Cert, devCerts.Key)
+}
+
+func parseCert(serverCrt, serverKey []byte) (*tls.Certificate, *x509.CertPool, error) {
 	cert, err := tls.X509KeyPair(serverCrt, serverKey)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "could not load server key pair")
@@ -3,116 +3,223 @@ package microtls
 import (
 	"crypto/tls"
 	"crypto/x509"
-	"reflect"
+	"encoding/pem"
+	"path/filepath"
 	"testing"
 )
 
+// setup writes a generated certificate pair to a temporary directory and points the package at it
+func setup(t *testing.T) *Certificates {
+	t.Helper()
+
+	certs, err := GenerateCertificates(&GenerateOptions{Hosts: []string{"localhost", "127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("GenerateCertificates() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	err = certs.WriteFiles(dir)
+	if err != nil {
+		t.Fatalf("WriteFiles() error = %v", err)
+	}
+
+	oldKey, oldCrt := key, crt
+	t.Cleanup(func() {
+		key, crt = oldKey, oldCrt
+		SetDevMode(false)
+	})
+
+	SetKeyAndCertPaths(filepath.Join(dir, "key.pem"), filepath.Join(dir, "cert.pem"))
+
+	return certs
+}
+
 func TestSetKeyAndCertPaths(t *testing.T) {
 	type args struct {
 		keyPath  string
 		certPath string
 	}
 	tests := []struct {
-		name string
-		args args
+		name     string
+		args     args
+		wantKey  string
+		wantCert string
 	}{
-		// TODO: Add test cases.
+		{
+			name:     "both paths",
+			args:     args{keyPath: "a/key.pem", certPath: "a/cert.pem"},
+			wantKey:  "a/key.pem",
+			wantCert: "a/cert.pem",
+		},
+		{
+			name:     "empty paths keep previous",
+			args:     args{keyPath: " ", certPath: ""},
+			wantKey:  "a/key.pem",
+			wantCert: "a/cert.pem",
+		},
 	}
+	oldKey, oldCrt := key, crt
+	defer func() { key, crt = oldKey, oldCrt }()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			SetKeyAndCertPaths(tt.args.keyPath, tt.args.certPath)
+			if key != tt.wantKey {
+				t.Errorf("key = %v, want %v", key, tt.wantKey)
+			}
+			if crt != tt.wantCert {
+				t.Errorf("crt = %v, want %v", crt, tt.wantCert)
+			}
 		})
 	}
 }
 
-func TestGetCert(t *testing.T) {
+func TestGenerateCertificates(t *testing.T) {
 	tests := []struct {
-		name    string
-		want    *tls.Certificate
-		want1   *x509.CertPool
-		wantErr bool
+		name      string
+		opt       *GenerateOptions
+		verifyFor string
+		wantErr   bool
 	}{
-		// TODO: Add test cases.
+		{name: "defaults", opt: nil, verifyFor: "localhost"},
+		{name: "service name", opt: &GenerateOptions{Hosts: []string{"account"}}, verifyFor: "account"},
+		{
+			name:      "k8s dns name",
+			opt:       &GenerateOptions{Hosts: []string{"account.default.svc.cluster.local"}},
+			verifyFor: "account.default.svc.cluster.local",
+		},
+		{name: "ip address", opt: &GenerateOptions{Hosts: []string{"10.0.0.1"}}, verifyFor: "10.0.0.1"},
+		{name: "wrong host", opt: &GenerateOptions{Hosts: []string{"account"}}, verifyFor: "payment", wantErr: true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1, err := GetCert()
-			if (err != nil) != tt.wantErr {
-				t.Errorf("GetCert() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			certs, err := GenerateCertificates(tt.opt)
+			if err != nil {
+				t.Fatalf("GenerateCertificates() error = %v", err)
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("GetCert() got = %v, want %v", got, tt.want)
+
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(certs.CACert) {
+				t.Fatal("failed to append CA to pool")
 			}
-			if !reflect.DeepEqual(got1, tt.want1) {
-				t.Errorf("GetCert() got1 = %v, want %v", got1, tt.want1)
+
+			block, _ := pem.Decode(certs.Cert)
+			leaf, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatalf("ParseCertificate() error = %v", err)
+			}
+
+			_, err = leaf.Verify(x509.VerifyOptions{DNSName: tt.verifyFor, Roots: roots})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
-func TestClientConfig(t *testing.T) {
+func TestGetCert(t *testing.T) {
 	tests := []struct {
 		name    string
-		want    *tls.Config
+		setup   func(t *testing.T)
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name:  "files exist",
+			setup: func(t *testing.T) { setup(t) },
+		},
+		{
+			name: "files missing",
+			setup: func(t *testing.T) {
+				setup(t)
+				SetKeyAndCertPaths("missing/key.pem", "missing/cert.pem")
+			},
+			wantErr: true,
+		},
+		{
+			name: "files missing in dev mode",
+			setup: func(t *testing.T) {
+				setup(t)
+				SetKeyAndCertPaths("missing/key.pem", "missing/cert.pem")
+				SetDevMode(true, "localhost")
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := ClientConfig()
+			tt.setup(t)
+			got, got1, err := GetCert()
 			if (err != nil) != tt.wantErr {
-				t.Errorf("ClientConfig() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("GetCert() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("ClientConfig() = %v, want %v", got, tt.want)
+			if got == nil || len(got.Certificate) == 0 {
+				t.Errorf("GetCert() got empty certificate")
+			}
+			if got1 == nil {
+				t.Errorf("GetCert() got nil pool")
 			}
 		})
 	}
 }
 
+func TestDevModeReusesCertificate(t *testing.T) {
+	setup(t)
+	SetKeyAndCertPaths("missing/key.pem", "missing/cert.pem")
+	SetDevMode(true)
+
+	first, _, err := GetCert()
+	if err != nil {
+		t.Fatalf("GetCert() error = %v", err)
+	}
+	second, _, err := GetCert()
+	if err != nil {
+		t.Fatalf("GetCert() error = %v", err)
+	}
+	if string(first.Certificate[0]) != string(second.Certificate[0]) {
+		t.Errorf("GetCert() generated a new certificate on each call")
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	setup(t)
+
+	got, err := ClientConfig()
+	if err != nil {
+		t.Fatalf("ClientConfig() error = %v", err)
+	}
+	if len(got.Certificates) != 1 || got.RootCAs == nil {
+		t.Errorf("ClientConfig() = %v, want certificate and root CAs", got)
+	}
+}
+
 func TestGRPCServerConfig(t *testing.T) {
-	tests := []struct {
-		name    string
-		want    *tls.Config
-		wantErr bool
-	}{
-		// TODO: Add test cases.
+	setup(t)
+
+	got, err := GRPCServerConfig()
+	if err != nil {
+		t.Fatalf("GRPCServerConfig() error = %v", err)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := GRPCServerConfig()
-			if (err != nil) != tt.wantErr {
-				t.Errorf("GRPCServerConfig() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("GRPCServerConfig() = %v, want %v", got, tt.want)
-			}
-		})
+	if got.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("GRPCServerConfig() ClientAuth = %v, want %v", got.ClientAuth, tls.VerifyClientCertIfGiven)
+	}
+	if len(got.Certificates) != 1 || got.ClientCAs == nil {
+		t.Errorf("GRPCServerConfig() = %v, want certificate and client CAs", got)
 	}
 }
 
 func TestHTTPServerConfig(t *testing.T) {
-	tests := []struct {
-		name    string
-		want    *tls.Config
-		wantErr bool
-	}{
-		// TODO: Add test cases.
+	setup(t)
+
+	got, err := HTTPServerConfig()
+	if err != nil {
+		t.Fatalf("HTTPServerConfig() error = %v", err)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := HTTPServerConfig()
-			if (err != nil) != tt.wantErr {
-				t.Errorf("HTTPServerConfig() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("HTTPServerConfig() = %v, want %v", got, tt.want)
-			}
-		})
+	if len(got.NextProtos) != 1 || got.NextProtos[0] != "h2" {
+		t.Errorf("HTTPServerConfig() NextProtos = %v, want [h2]", got.NextProtos)
+	}
+	if len(got.Certificates) != 1 || got.ClientCAs == nil {
+		t.Errorf("HTTPServerConfig() = %v, want certificate and client CAs", got)
 	}
 }
@@ -0,0 +1,15 @@
+package micros
+
+import (
+	grpc_middleware "github.com/gidyon/micros/pkg/grpc/middleware"
+)
+
+// EnableValidation validates gRPC and gateway requests whose messages implement ValidateAll() or Validate(),
+// as generated by protoc-gen-validate. Invalid requests fail with codes.InvalidArgument and
+// errdetails.BadRequest field violations, rendered by the gateway as 400 Bad Request.
+// It must be called before InitGRPC
+func (service *Service) EnableValidation() {
+	unary, stream := grpc_middleware.AddValidation()
+	service.AddGRPCUnaryServerInterceptors(unary...)
+	service.AddGRPCStreamServerInterceptors(stream...)
+}
@@ -0,0 +1,27 @@
+package micros
+
+import (
+	"context"
+	"github.com/gidyon/micros/pkg/worker"
+	"github.com/pkg/errors"
+)
+
+// AddStreamWorker registers a worker processing the redis stream in opt with handler using the service
+// redis client. Workers start when the service runs, stop when it shuts down and are reported by CheckHealth
+func (service *Service) AddStreamWorker(opt *worker.Options, handler worker.Handler) (*worker.Worker, error) {
+	if service.redisClient == nil {
+		return nil, errors.New("stream workers require a redis client")
+	}
+
+	w, err := worker.New(service.redisClient, opt, handler, service.logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create stream worker")
+	}
+
+	service.addBackgroundTask("stream worker "+w.Name(), w.Run)
+	service.AddHealthCheck("stream worker "+w.Name(), func(context.Context) error {
+		return w.Health()
+	})
+
+	return w, nil
+}